@@ -0,0 +1,72 @@
+// carrier/carrier.go
+package carrier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Parcel describes one physical package handed to a carrier
+type Parcel struct {
+	Weight float64
+	Length float64
+	Width  float64
+	Height float64
+}
+
+// Request is a shipment booking sent to a carrier
+type Request struct {
+	Reference string
+	Service   string
+	Parcels   []Parcel
+}
+
+// Result holds the tracking numbers assigned by the carrier.
+// ParcelTrackingNumbers is in the same order as Request.Parcels.
+type Result struct {
+	TrackingNumber        string
+	ParcelTrackingNumbers []string
+}
+
+// Carrier books shipments with a transport provider
+type Carrier interface {
+	Name() string
+	Ship(ctx context.Context, req Request) (*Result, error)
+}
+
+var (
+	mu       sync.RWMutex
+	carriers = map[string]Carrier{}
+)
+
+// Register makes a carrier available under its name, replacing any previous one
+func Register(c Carrier) {
+	mu.Lock()
+	defer mu.Unlock()
+	carriers[c.Name()] = c
+}
+
+// Get returns the carrier registered under name
+func Get(name string) (Carrier, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := carriers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown carrier %q", name)
+	}
+	return c, nil
+}
+
+// Names returns the names of all registered carriers
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(carriers))
+	for name := range carriers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,42 @@
+// carrier/fake.go
+package carrier
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+func init() {
+	Register(Fake{})
+}
+
+// Fake is a local carrier that books nothing and hands out random tracking
+// numbers. It is useful for development and for sites without an integration.
+type Fake struct{}
+
+// Name returns the carrier name used in shipment records
+func (Fake) Name() string {
+	return "fake"
+}
+
+// Ship returns one tracking number for the shipment and one per parcel
+func (Fake) Ship(ctx context.Context, req Request) (*Result, error) {
+	if len(req.Parcels) == 0 {
+		return nil, fmt.Errorf("shipment %s has no parcels", req.Reference)
+	}
+
+	result := &Result{TrackingNumber: fakeTrackingNumber()}
+	for range req.Parcels {
+		result.ParcelTrackingNumbers = append(result.ParcelTrackingNumbers, fakeTrackingNumber())
+	}
+	return result, nil
+}
+
+// fakeTrackingNumber returns a random tracking number such as FK1A2B3C4D5E6F
+func fakeTrackingNumber() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "FK" + hex.EncodeToString(b)
+}
@@ -8,9 +8,11 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `toml:"server"`
-	Database DatabaseConfig `toml:"database"`
-	JWT      JWTConfig      `toml:"jwt"`
+	Server    ServerConfig    `toml:"server"`
+	Database  DatabaseConfig  `toml:"database"`
+	JWT       JWTConfig       `toml:"jwt"`
+	Labels    LabelsConfig    `toml:"labels"`
+	Inventory InventoryConfig `toml:"inventory"`
 }
 
 type ServerConfig struct {
@@ -33,6 +35,28 @@ type JWTConfig struct {
 	TokenExpiryHours int    `toml:"token_expiry_hours"`
 }
 
+// InventoryConfig holds stock valuation settings
+type InventoryConfig struct {
+	CostingMethod string `toml:"costing_method"` // fifo (default), average or standard
+}
+
+// LabelsConfig holds the printer resolution and the label templates by name
+type LabelsConfig struct {
+	DPI       int                      `toml:"dpi"`
+	Templates map[string]LabelTemplate `toml:"templates"`
+}
+
+// LabelTemplate describes the size, barcode and text lines of a label.
+// Barcode and Lines are Go text/template strings, e.g. "{{.Code}}".
+type LabelTemplate struct {
+	Kind      string   `toml:"kind"` // bin, product or package
+	WidthMM   float64  `toml:"width_mm"`
+	HeightMM  float64  `toml:"height_mm"`
+	Symbology string   `toml:"symbology"` // code128 or qr
+	Barcode   string   `toml:"barcode"`
+	Lines     []string `toml:"lines"`
+}
+
 // LoadConfig loads the configuration from the TOML file
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
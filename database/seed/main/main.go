@@ -18,7 +18,64 @@ func main() {
 
 	// Ensure tables exist
 	log.Println("Migrating database...")
-	db.AutoMigrate(&models.Product{}, &models.User{})
+	if err := models.MigrateProductPrices(db); err != nil {
+		log.Fatal("failed to migrate product prices:", err)
+	}
+	if err := models.MigrateProductCodes(db); err != nil {
+		log.Fatal("failed to migrate product codes:", err)
+	}
+	if err := models.MigrateStockLevelKey(db); err != nil {
+		log.Fatal("failed to migrate stock level key:", err)
+	}
+	if err := db.AutoMigrate(
+		&models.UnitOfMeasure{},
+		&models.Attribute{},
+		&models.AttributeValue{},
+		&models.Category{},
+		&models.Product{},
+		&models.ProductUnit{},
+		&models.Barcode{},
+		&models.User{},
+		&models.Warehouse{},
+		&models.Zone{},
+		&models.BinLocation{},
+		&models.Lot{},
+		&models.SerialNumber{},
+		&models.StockLevel{},
+		&models.StockMovement{},
+		&models.Sequence{},
+		&models.Supplier{},
+		&models.PurchaseOrder{},
+		&models.PurchaseOrderLine{},
+		&models.CustomerGroup{},
+		&models.Customer{},
+		&models.SalesOrder{},
+		&models.SalesOrderLine{},
+		&models.StockReservation{},
+		&models.Wave{},
+		&models.PickList{},
+		&models.PickListLine{},
+		&models.Shipment{},
+		&models.Package{},
+		&models.PackageLine{},
+		&models.CountSession{},
+		&models.CountLine{},
+		&models.ReorderRule{},
+		&models.BOMLine{},
+		&models.WorkOrder{},
+		&models.WorkOrderLine{},
+		&models.ReturnAuthorization{},
+		&models.ReturnLine{},
+		&models.ReturnReceipt{},
+		&models.TransferOrder{},
+		&models.TransferOrderLine{},
+		&models.CostLayer{},
+		&models.PriceList{},
+		&models.PriceListItem{},
+		&models.ExchangeRate{},
+	); err != nil {
+		log.Fatal("failed to migrate database:", err)
+	}
 
 	// Run Seeders
 	log.Println("Seeding users...")
@@ -26,10 +83,20 @@ func main() {
 		log.Fatal("failed to seed users:", err)
 	}
 
+	log.Println("Seeding units of measure...")
+	if err := seed.SeedUnits(db); err != nil {
+		log.Fatal("failed to seed units of measure:", err)
+	}
+
 	log.Println("Seeding products...")
 	if err := seed.SeedProducts(db); err != nil {
 		log.Fatal("failed to seed products:", err)
 	}
 
+	log.Println("Seeding warehouses...")
+	if err := seed.SeedWarehouses(db); err != nil {
+		log.Fatal("failed to seed warehouses:", err)
+	}
+
 	log.Println("Seeding completed successfully!")
 }
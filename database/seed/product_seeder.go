@@ -8,16 +8,16 @@ import (
 // SeedProducts populates the database with initial product data
 func SeedProducts(db *gorm.DB) error {
 	products := []models.Product{
-		{Name: "Laptop Pro", Price: 1500.00, Status: "active"},
-		{Name: "Wireless Mouse", Price: 25.50, Status: "active"},
-		{Name: "Mechanical Keyboard", Price: 89.99, Status: "active"},
-		{Name: "USB-C Hub", Price: 45.00, Status: "inactive"},
-		{Name: "Monitor 4K", Price: 350.00, Status: "active"},
-		{Name: "Gaming Chair", Price: 299.99, Status: "active"},
-		{Name: "Webcam HD", Price: 59.99, Status: "active"},
-		{Name: "Desk Lamp", Price: 19.99, Status: "inactive"},
-		{Name: "External SSD 1TB", Price: 120.00, Status: "active"},
-		{Name: "Noise Cancelling Headphones", Price: 199.00, Status: "active"},
+		{Name: "Laptop Pro", SKU: "LAPTOP-PRO", PriceAmount: 150000, Status: "active"},
+		{Name: "Wireless Mouse", SKU: "MOUSE-WL", PriceAmount: 2550, Status: "active"},
+		{Name: "Mechanical Keyboard", SKU: "KEYB-MECH", PriceAmount: 8999, Status: "active"},
+		{Name: "USB-C Hub", SKU: "HUB-USBC", PriceAmount: 4500, Status: "inactive"},
+		{Name: "Monitor 4K", SKU: "MON-4K", PriceAmount: 35000, Status: "active"},
+		{Name: "Gaming Chair", SKU: "CHAIR-GAMING", PriceAmount: 29999, Status: "active"},
+		{Name: "Webcam HD", SKU: "WEBCAM-HD", PriceAmount: 5999, Status: "active"},
+		{Name: "Desk Lamp", SKU: "LAMP-DESK", PriceAmount: 1999, Status: "inactive"},
+		{Name: "External SSD 1TB", SKU: "SSD-1TB", PriceAmount: 12000, Status: "active"},
+		{Name: "Noise Cancelling Headphones", SKU: "HEADPHONES-NC", PriceAmount: 19900, Status: "active"},
 	}
 
 	for _, p := range products {
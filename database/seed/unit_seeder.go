@@ -0,0 +1,28 @@
+package seed
+
+import (
+	"github.com/aldhipradana/warehouse-api/models"
+	"gorm.io/gorm"
+)
+
+// SeedUnits populates the database with common units of measure
+func SeedUnits(db *gorm.DB) error {
+	units := []models.UnitOfMeasure{
+		{Code: "EA", Name: "Each"},
+		{Code: "PK", Name: "Pack"},
+		{Code: "CS", Name: "Case"},
+		{Code: "PAL", Name: "Pallet"},
+		{Code: "KG", Name: "Kilogram"},
+	}
+
+	for _, u := range units {
+		var count int64
+		db.Model(&models.UnitOfMeasure{}).Where("code = ?", u.Code).Count(&count)
+		if count == 0 {
+			if err := db.Create(&u).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package seed
+
+import (
+	"fmt"
+
+	"github.com/aldhipradana/warehouse-api/models"
+	"gorm.io/gorm"
+)
+
+// SeedWarehouses populates the database with a main warehouse, its zones and bin locations
+func SeedWarehouses(db *gorm.DB) error {
+	var count int64
+	db.Model(&models.Warehouse{}).Where("code = ?", "MAIN").Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	warehouse := models.Warehouse{Code: "MAIN", Name: "Main Warehouse", Address: "1 Dock Street", Status: "active"}
+	if err := db.Create(&warehouse).Error; err != nil {
+		return err
+	}
+
+	for _, zoneCode := range []string{"A", "B"} {
+		zone := models.Zone{WarehouseID: warehouse.ID, Code: zoneCode, Name: "Zone " + zoneCode}
+		if err := db.Create(&zone).Error; err != nil {
+			return err
+		}
+
+		for i := 1; i <= 5; i++ {
+			bin := models.BinLocation{ZoneID: zone.ID, Code: fmt.Sprintf("%s-01-%02d", zoneCode, i)}
+			if err := db.Create(&bin).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// inventory/assembly.go
+package inventory
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/models"
+	"gorm.io/gorm"
+)
+
+// Consume takes m.Quantity of m.ProductID out of the storage bins of a
+// warehouse, posting one consume movement per stock level it draws from
+func Consume(tx *gorm.DB, m models.StockMovement, warehouseID uint) error {
+	m.Type = models.MovementConsume
+	m.ToBinLocationID = nil
+	return Draw(tx, m, warehouseID)
+}
+
+// Draw takes m.Quantity of m.ProductID out of the storage bins of a
+// warehouse, posting one movement of m.Type per stock level it draws from.
+// Stock in m.FromBinLocationID is used first, then lots first-expired-first-out;
+// expired lots and reserved units are never used. A lot number restricts
+// the draw to that lot.
+func Draw(tx *gorm.DB, m models.StockMovement, warehouseID uint) error {
+	query := ForUpdate(tx).
+		Where("product_id = ? AND quantity > reserved", m.ProductID).
+		Where("bin_location_id IN (?)", tx.Model(&models.BinLocation{}).Select("id").
+			Where("warehouse_id = ? AND type = ?", warehouseID, models.BinTypeStorage)).
+		Order("id")
+	if m.LotNumber != "" {
+		query = query.Where("lot_id IN (?)", tx.Model(&models.Lot{}).Select("id").
+			Where("product_id = ? AND number = ?", m.ProductID, m.LotNumber))
+	}
+	var levels []models.StockLevel
+	if err := query.Find(&levels).Error; err != nil {
+		return err
+	}
+	if err := sortFEFO(tx, levels); err != nil {
+		return err
+	}
+	if m.FromBinLocationID != nil {
+		preferred := *m.FromBinLocationID
+		sort.SliceStable(levels, func(i, j int) bool {
+			return levels[i].BinLocationID == preferred && levels[j].BinLocationID != preferred
+		})
+	}
+
+	now := time.Now()
+	remaining := m.Quantity
+	for _, level := range levels {
+		if remaining <= 0 {
+			break
+		}
+		if level.Lot != nil && level.Lot.Expired(now) {
+			continue
+		}
+
+		movement := m
+		movement.FromBinLocationID = &level.BinLocationID
+		movement.Quantity = math.Min(level.Available(), remaining)
+		movement.LotNumber = ""
+		movement.LotID = nil
+		if level.LotID != 0 {
+			lotID := level.LotID
+			movement.LotID = &lotID
+		}
+		if err := Post(tx, &movement); err != nil {
+			return err
+		}
+		remaining -= movement.Quantity
+	}
+
+	if remaining > 1e-9 {
+		return fmt.Errorf("%w: %v more of product %d needed in warehouse %d", ErrInsufficientStock, remaining, m.ProductID, warehouseID)
+	}
+	return nil
+}
+
+// ComponentAvailability is how many kits one component can supply
+type ComponentAvailability struct {
+	ComponentID uint    `json:"component_id"`
+	Name        string  `json:"name"`
+	QuantityPer float64 `json:"quantity_per"`
+	Available   float64 `json:"available"`
+	Kits        float64 `json:"kits"`
+}
+
+// KitAvailability is the availability of a kit in one warehouse: what is
+// already assembled plus what can be built from the components
+type KitAvailability struct {
+	ProductID   uint                    `json:"product_id"`
+	WarehouseID uint                    `json:"warehouse_id"`
+	OnHand      float64                 `json:"on_hand"`
+	Buildable   float64                 `json:"buildable"`
+	Available   float64                 `json:"available"`
+	Components  []ComponentAvailability `json:"components"`
+}
+
+// Availability computes the availability of a product in a warehouse. For
+// kits the buildable quantity is limited by the scarcest component, and
+// components that are kits themselves count what they could be built from.
+// Components are evaluated independently, so stock shared by two components
+// is counted for both.
+func Availability(tx *gorm.DB, productID, warehouseID uint) (*KitAvailability, error) {
+	var product models.Product
+	if err := tx.Preload("Components.Component").First(&product, productID).Error; err != nil {
+		return nil, err
+	}
+
+	onHand, err := storageAvailable(tx, productID, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	result := &KitAvailability{ProductID: productID, WarehouseID: warehouseID, OnHand: onHand, Available: onHand, Components: []ComponentAvailability{}}
+	if len(product.Components) == 0 {
+		return result, nil
+	}
+
+	buildable := math.Inf(1)
+	for _, line := range product.Components {
+		component, err := Availability(tx, line.ComponentID, warehouseID)
+		if err != nil {
+			return nil, err
+		}
+		kits := component.Available / line.Quantity
+		if !product.Divisible {
+			kits = math.Floor(kits + 1e-9)
+		}
+		name := ""
+		if line.Component != nil {
+			name = line.Component.Name
+		}
+		result.Components = append(result.Components, ComponentAvailability{
+			ComponentID: line.ComponentID,
+			Name:        name,
+			QuantityPer: line.Quantity,
+			Available:   component.Available,
+			Kits:        kits,
+		})
+		buildable = math.Min(buildable, kits)
+	}
+	result.Buildable = math.Max(buildable, 0)
+	result.Available += result.Buildable
+	return result, nil
+}
+
+// storageAvailable sums the unreserved quantity of a product in the storage
+// bins of a warehouse, leaving out expired lots
+func storageAvailable(tx *gorm.DB, productID, warehouseID uint) (float64, error) {
+	var available float64
+	err := tx.Model(&models.StockLevel{}).
+		Select("COALESCE(SUM(stock_levels.quantity - stock_levels.reserved), 0)").
+		Joins("JOIN bin_locations ON bin_locations.id = stock_levels.bin_location_id").
+		Joins("LEFT JOIN lots ON lots.id = stock_levels.lot_id").
+		Where("stock_levels.product_id = ? AND bin_locations.warehouse_id = ? AND bin_locations.type = ?", productID, warehouseID, models.BinTypeStorage).
+		Where("lots.expires_at IS NULL OR lots.expires_at > ?", time.Now()).
+		Scan(&available).Error
+	return available, err
+}
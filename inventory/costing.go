@@ -0,0 +1,338 @@
+// inventory/costing.go
+package inventory
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/aldhipradana/warehouse-api/models"
+	"gorm.io/gorm"
+)
+
+// Costing methods
+const (
+	// CostingFIFO charges outgoing stock at the cost of the oldest layers
+	CostingFIFO = "fifo"
+	// CostingAverage charges outgoing stock at the moving weighted average cost
+	CostingAverage = "average"
+	// CostingStandard values all stock at the product's standard cost
+	CostingStandard = "standard"
+)
+
+var costingMethod = CostingFIFO
+
+func init() {
+	models.OnStandardCostChange = revalueStandardCost
+}
+
+// SetCostingMethod selects how stock is valued. An empty method means FIFO.
+func SetCostingMethod(method string) error {
+	switch method {
+	case "":
+		costingMethod = CostingFIFO
+	case CostingFIFO, CostingAverage, CostingStandard:
+		costingMethod = method
+	default:
+		return fmt.Errorf("unknown costing method %q", method)
+	}
+	return nil
+}
+
+// CostingMethod returns the configured costing method
+func CostingMethod() string {
+	return costingMethod
+}
+
+// UnitCost returns the current cost per base unit of a product in a warehouse
+func UnitCost(tx *gorm.DB, productID, warehouseID uint) (float64, error) {
+	var product models.Product
+	if err := tx.First(&product, productID).Error; err != nil {
+		return 0, err
+	}
+	return unitCost(tx, &product, warehouseID)
+}
+
+// unitCost is the standard cost under standard costing, otherwise the
+// average cost of the open layers. Without open layers the cost of the
+// latest layer, and then the standard cost, stand in.
+func unitCost(tx *gorm.DB, product *models.Product, warehouseID uint) (float64, error) {
+	if costingMethod == CostingStandard {
+		return product.StandardCost, nil
+	}
+
+	var open struct {
+		Quantity float64
+		Value    float64
+	}
+	err := tx.Model(&models.CostLayer{}).
+		Select("COALESCE(SUM(remaining), 0) AS quantity, COALESCE(SUM(remaining * unit_cost), 0) AS value").
+		Where("product_id = ? AND warehouse_id = ? AND remaining > 0", product.ID, warehouseID).
+		Scan(&open).Error
+	if err != nil {
+		return 0, err
+	}
+	if open.Quantity > 1e-9 {
+		return roundCost(open.Value / open.Quantity), nil
+	}
+
+	var last models.CostLayer
+	if err := tx.Where("product_id = ? AND warehouse_id = ?", product.ID, warehouseID).Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+		return 0, err
+	}
+	if last.ID != 0 {
+		return last.UnitCost, nil
+	}
+	return product.StandardCost, nil
+}
+
+// revalueStandardCost books a new standard cost on the stock on hand under
+// standard costing, with a revalue movement per stock level, so the ledger
+// values stock at the standard in effect at any date
+func revalueStandardCost(tx *gorm.DB, product *models.Product, previous float64) error {
+	if costingMethod != CostingStandard {
+		return nil
+	}
+	var levels []models.StockLevel
+	if err := tx.Where("product_id = ? AND quantity <> 0", product.ID).Order("id").Find(&levels).Error; err != nil {
+		return err
+	}
+	for _, level := range levels {
+		movement := models.StockMovement{
+			Type:            models.MovementRevalue,
+			ProductID:       product.ID,
+			ToBinLocationID: &level.BinLocationID,
+			UnitCost:        product.StandardCost,
+			CostAmount:      roundCost(level.Quantity * (product.StandardCost - previous)),
+			Reason:          fmt.Sprintf("Standard cost changed from %g to %g", previous, product.StandardCost),
+		}
+		if level.LotID != 0 {
+			movement.LotID = &level.LotID
+		}
+		if err := tx.Create(&movement).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(&models.CostLayer{}).
+		Where("product_id = ? AND remaining > 0", product.ID).
+		Update("unit_cost", product.StandardCost).Error
+}
+
+// valueMovement sets UnitCost and CostAmount of a movement and returns the
+// warehouse it brings stock into, if any. Stock leaving a warehouse is charged
+// from its cost layers; stock entering one keeps the movement's unit cost or
+// gets the current cost. Transfers within a warehouse carry no cost.
+func valueMovement(tx *gorm.DB, m *models.StockMovement, product *models.Product) (uint, error) {
+	if m.UnitCost < 0 {
+		return 0, fmt.Errorf("%w: unit cost cannot be negative", ErrInvalidMovement)
+	}
+	fromID, err := binWarehouse(tx, m.FromBinLocationID)
+	if err != nil {
+		return 0, err
+	}
+	toID, err := binWarehouse(tx, m.ToBinLocationID)
+	if err != nil {
+		return 0, err
+	}
+	if fromID != 0 && fromID == toID {
+		m.UnitCost, m.CostAmount = 0, 0
+		return 0, nil
+	}
+
+	if fromID != 0 {
+		amount, err := drawLayers(tx, product, fromID, m.Quantity)
+		if err != nil {
+			return 0, err
+		}
+		m.CostAmount = roundCost(amount)
+		m.UnitCost = roundCost(amount / m.Quantity)
+		return toID, nil
+	}
+
+	if costingMethod == CostingStandard {
+		m.UnitCost = product.StandardCost
+	} else if m.UnitCost == 0 {
+		if m.UnitCost, err = unitCost(tx, product, toID); err != nil {
+			return 0, err
+		}
+	}
+	m.CostAmount = roundCost(m.UnitCost * m.Quantity)
+	return toID, nil
+}
+
+// drawLayers takes qty out of the open cost layers of a product in a
+// warehouse, oldest first, and returns its cost. Stock without layers (it
+// predates costing) is charged at the current cost.
+func drawLayers(tx *gorm.DB, product *models.Product, warehouseID uint, qty float64) (float64, error) {
+	var layers []models.CostLayer
+	err := ForUpdate(tx).
+		Where("product_id = ? AND warehouse_id = ? AND remaining > 0", product.ID, warehouseID).
+		Order("id").
+		Find(&layers).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var amount float64
+	remaining := qty
+	for _, layer := range layers {
+		if remaining <= 1e-9 {
+			break
+		}
+		take := math.Min(layer.Remaining, remaining)
+		if err := tx.Model(&layer).Update("remaining", roundCost(layer.Remaining-take)).Error; err != nil {
+			return 0, err
+		}
+		amount += take * layer.UnitCost
+		remaining -= take
+	}
+	if remaining > 1e-9 {
+		cost, err := unitCost(tx, product, warehouseID)
+		if err != nil {
+			return 0, err
+		}
+		amount += remaining * cost
+	}
+
+	if costingMethod == CostingStandard {
+		amount = qty * product.StandardCost
+	}
+	return amount, nil
+}
+
+// addLayer opens a cost layer for a posted movement that brought stock into
+// a warehouse
+func addLayer(tx *gorm.DB, m *models.StockMovement, warehouseID uint) error {
+	return openLayer(tx, m.ProductID, warehouseID, m.ID, m.Quantity, m.UnitCost)
+}
+
+// openLayer opens a cost layer. Under average costing all open layers are
+// then revalued at the new weighted average.
+func openLayer(tx *gorm.DB, productID, warehouseID, movementID uint, qty, cost float64) error {
+	layer := models.CostLayer{
+		ProductID:       productID,
+		WarehouseID:     warehouseID,
+		StockMovementID: movementID,
+		Quantity:        qty,
+		Remaining:       qty,
+		UnitCost:        cost,
+	}
+	if err := tx.Create(&layer).Error; err != nil {
+		return err
+	}
+	if costingMethod != CostingAverage {
+		return nil
+	}
+
+	average, err := unitCost(tx, &models.Product{Model: gorm.Model{ID: productID}}, warehouseID)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.CostLayer{}).
+		Where("product_id = ? AND warehouse_id = ? AND remaining > 0", productID, warehouseID).
+		Update("unit_cost", average).Error
+}
+
+// MigrateOpeningCosts opens cost layers for stock on hand that no layer
+// covers, i.e. stock received before movements were costed. It is valued
+// at the product's standard cost and a revalue movement per stock level
+// books that value, so the valuation report agrees with the layers. Layers
+// follow stock everywhere else, so once they cover it this does nothing;
+// it must run after SetCostingMethod and before any stock moves.
+func MigrateOpeningCosts(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var levels []struct {
+			ProductID     uint
+			WarehouseID   uint
+			BinLocationID uint
+			LotID         uint
+			Quantity      float64
+		}
+		err := tx.Model(&models.StockLevel{}).
+			Select("stock_levels.product_id, bin_locations.warehouse_id, stock_levels.bin_location_id, stock_levels.lot_id, stock_levels.quantity").
+			Joins("JOIN bin_locations ON bin_locations.id = stock_levels.bin_location_id").
+			Where("stock_levels.quantity > 0").
+			Order("stock_levels.product_id, bin_locations.warehouse_id, stock_levels.id").
+			Scan(&levels).Error
+		if err != nil {
+			return err
+		}
+
+		var layered []struct {
+			ProductID   uint
+			WarehouseID uint
+			Remaining   float64
+		}
+		err = tx.Model(&models.CostLayer{}).
+			Select("product_id, warehouse_id, SUM(remaining) AS remaining").
+			Where("remaining > 0").
+			Group("product_id, warehouse_id").
+			Scan(&layered).Error
+		if err != nil {
+			return err
+		}
+		type key struct{ productID, warehouseID uint }
+		covered := map[key]float64{}
+		for _, row := range layered {
+			covered[key{row.ProductID, row.WarehouseID}] = row.Remaining
+		}
+
+		// Levels of a product and warehouse are walked in order and take the
+		// layers that exist first; the rest gets an opening layer
+		products := map[uint]*models.Product{}
+		for _, level := range levels {
+			k := key{level.ProductID, level.WarehouseID}
+			take := math.Min(covered[k], level.Quantity)
+			covered[k] -= take
+			missing := roundCost(level.Quantity - take)
+			if missing <= 1e-9 {
+				continue
+			}
+
+			product, ok := products[level.ProductID]
+			if !ok {
+				product = &models.Product{}
+				if err := tx.Unscoped().Select("id", "standard_cost").First(product, level.ProductID).Error; err != nil {
+					return err
+				}
+				products[level.ProductID] = product
+			}
+			binID := level.BinLocationID
+			movement := models.StockMovement{
+				Type:            models.MovementRevalue,
+				ProductID:       level.ProductID,
+				ToBinLocationID: &binID,
+				UnitCost:        product.StandardCost,
+				CostAmount:      roundCost(missing * product.StandardCost),
+				Reason:          fmt.Sprintf("Opening cost of %g units received before costing", missing),
+			}
+			if level.LotID != 0 {
+				lotID := level.LotID
+				movement.LotID = &lotID
+			}
+			if err := tx.Create(&movement).Error; err != nil {
+				return err
+			}
+			if err := openLayer(tx, level.ProductID, level.WarehouseID, movement.ID, missing, product.StandardCost); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// binWarehouse returns the warehouse of a bin, or 0 for no bin
+func binWarehouse(tx *gorm.DB, binID *uint) (uint, error) {
+	if binID == nil {
+		return 0, nil
+	}
+	var bin models.BinLocation
+	if err := tx.Select("id", "warehouse_id").First(&bin, *binID).Error; err != nil {
+		return 0, err
+	}
+	return bin.WarehouseID, nil
+}
+
+// roundCost rounds a cost to six decimals to keep float noise out of the ledger
+func roundCost(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
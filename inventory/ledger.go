@@ -0,0 +1,278 @@
+// inventory/ledger.go
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInsufficientStock is returned when a movement or reservation needs more than is available
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrInvalidMovement is returned when a movement is malformed
+	ErrInvalidMovement = errors.New("invalid stock movement")
+	// ErrExpiredLot is returned when an issue or consume takes stock from an expired lot without an override
+	ErrExpiredLot = errors.New("lot has expired")
+)
+
+// Post validates a movement, applies it to the affected stock levels, values
+// it with the configured costing method and appends it to the ledger. It must
+// be called inside Transaction so the balance update and the ledger row
+// commit together.
+func Post(tx *gorm.DB, m *models.StockMovement) error {
+	product, err := validate(tx, m)
+	if err != nil {
+		return err
+	}
+	if !product.Divisible && m.Quantity != math.Trunc(m.Quantity) {
+		return fmt.Errorf("%w: product %d is not divisible, quantity must be a whole number", ErrInvalidMovement, m.ProductID)
+	}
+
+	switch product.Tracking {
+	case models.TrackingLot:
+		if err := resolveLot(tx, m); err != nil {
+			return err
+		}
+	case models.TrackingSerial:
+		if err := resolveSerials(tx, m); err != nil {
+			return err
+		}
+	default:
+		if m.LotNumber != "" || m.LotID != nil || len(m.SerialNumbers) > 0 {
+			return fmt.Errorf("%w: product %d is not lot or serial tracked", ErrInvalidMovement, m.ProductID)
+		}
+	}
+
+	var lotID uint
+	if m.LotID != nil {
+		lotID = *m.LotID
+	}
+	if m.FromBinLocationID != nil {
+		if err := decrement(tx, m.ProductID, *m.FromBinLocationID, lotID, m.Quantity); err != nil {
+			return err
+		}
+	}
+	if m.ToBinLocationID != nil {
+		if err := increment(tx, m.ProductID, *m.ToBinLocationID, lotID, m.Quantity); err != nil {
+			return err
+		}
+	}
+
+	warehouseID, err := valueMovement(tx, m, product)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Omit("Serials.*").Create(m).Error; err != nil {
+		return err
+	}
+	if warehouseID != 0 {
+		if err := addLayer(tx, m, warehouseID); err != nil {
+			return err
+		}
+	}
+	return moveSerials(tx, m)
+}
+
+// validate checks the quantity, the locations required by the movement type
+// and that the referenced product and bins exist
+func validate(tx *gorm.DB, m *models.StockMovement) (*models.Product, error) {
+	if m.Quantity <= 0 {
+		return nil, fmt.Errorf("%w: quantity must be greater than zero", ErrInvalidMovement)
+	}
+
+	hasFrom := m.FromBinLocationID != nil
+	hasTo := m.ToBinLocationID != nil
+	switch m.Type {
+	case models.MovementReceive, models.MovementProduce:
+		if hasFrom || !hasTo {
+			return nil, fmt.Errorf("%w: %s requires only a destination bin", ErrInvalidMovement, m.Type)
+		}
+	case models.MovementIssue, models.MovementConsume:
+		if !hasFrom || hasTo {
+			return nil, fmt.Errorf("%w: %s requires only a source bin", ErrInvalidMovement, m.Type)
+		}
+	case models.MovementTransfer:
+		if !hasFrom || !hasTo {
+			return nil, fmt.Errorf("%w: transfer requires a source and a destination bin", ErrInvalidMovement)
+		}
+		if *m.FromBinLocationID == *m.ToBinLocationID {
+			return nil, fmt.Errorf("%w: source and destination bin must differ", ErrInvalidMovement)
+		}
+	case models.MovementAdjust:
+		if hasFrom == hasTo {
+			return nil, fmt.Errorf("%w: adjust requires either a source or a destination bin", ErrInvalidMovement)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown movement type %q", ErrInvalidMovement, m.Type)
+	}
+
+	var product models.Product
+	if err := tx.First(&product, m.ProductID).Error; err != nil {
+		return nil, fmt.Errorf("%w: product %d not found", ErrInvalidMovement, m.ProductID)
+	}
+	var count int64
+	for _, binID := range []*uint{m.FromBinLocationID, m.ToBinLocationID} {
+		if binID == nil {
+			continue
+		}
+		tx.Model(&models.BinLocation{}).Where("id = ?", *binID).Count(&count)
+		if count == 0 {
+			return nil, fmt.Errorf("%w: bin location %d not found", ErrInvalidMovement, *binID)
+		}
+	}
+	return &product, nil
+}
+
+// resolveLot sets the movement's LotID from its lot number. Stock coming in
+// may create the lot and set its expiry date, stock going out must name a
+// lot that already exists and, for issues, has not expired.
+func resolveLot(tx *gorm.DB, m *models.StockMovement) error {
+	if len(m.SerialNumbers) > 0 {
+		return fmt.Errorf("%w: product %d is lot tracked, not serial tracked", ErrInvalidMovement, m.ProductID)
+	}
+
+	var lot models.Lot
+	switch {
+	case m.LotID != nil && m.LotNumber == "":
+		if err := tx.Where("id = ? AND product_id = ?", *m.LotID, m.ProductID).First(&lot).Error; err != nil {
+			return fmt.Errorf("%w: lot %d not found for product %d", ErrInvalidMovement, *m.LotID, m.ProductID)
+		}
+	case m.LotNumber == "":
+		return fmt.Errorf("%w: product %d is lot tracked, a lot number is required", ErrInvalidMovement, m.ProductID)
+	default:
+		lot = models.Lot{ProductID: m.ProductID, Number: m.LotNumber, ExpiresAt: m.ExpiresAt}
+		if m.FromBinLocationID == nil {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&lot).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("product_id = ? AND number = ?", m.ProductID, m.LotNumber).First(&lot).Error; err != nil {
+			return fmt.Errorf("%w: lot %s not found for product %d", ErrInvalidMovement, m.LotNumber, m.ProductID)
+		}
+	}
+
+	if m.ExpiresAt != nil && m.FromBinLocationID == nil {
+		if lot.ExpiresAt == nil {
+			lot.ExpiresAt = m.ExpiresAt
+			if err := tx.Model(&lot).Update("expires_at", lot.ExpiresAt).Error; err != nil {
+				return err
+			}
+		} else if !lot.ExpiresAt.Equal(*m.ExpiresAt) {
+			return fmt.Errorf("%w: lot %s already expires on %s", ErrInvalidMovement, lot.Number, lot.ExpiresAt.Format(time.DateOnly))
+		}
+	}
+	if (m.Type == models.MovementIssue || m.Type == models.MovementConsume) && lot.Expired(time.Now()) && !m.AllowExpired {
+		return fmt.Errorf("%w: lot %s expired on %s", ErrExpiredLot, lot.Number, lot.ExpiresAt.Format(time.DateOnly))
+	}
+
+	m.LotID = &lot.ID
+	return nil
+}
+
+// resolveSerials loads the serial numbers carried by the movement and checks
+// that each one is where the movement says it comes from. Incoming serials
+// that have never been seen before are created.
+func resolveSerials(tx *gorm.DB, m *models.StockMovement) error {
+	if m.LotNumber != "" || m.LotID != nil {
+		return fmt.Errorf("%w: product %d is serial tracked, not lot tracked", ErrInvalidMovement, m.ProductID)
+	}
+	if m.Quantity != math.Trunc(m.Quantity) || int(m.Quantity) != len(m.SerialNumbers) {
+		return fmt.Errorf("%w: product %d is serial tracked, expected %g serial numbers but got %d",
+			ErrInvalidMovement, m.ProductID, m.Quantity, len(m.SerialNumbers))
+	}
+
+	seen := map[string]bool{}
+	m.Serials = make([]models.SerialNumber, 0, len(m.SerialNumbers))
+	for _, number := range m.SerialNumbers {
+		if number == "" || seen[number] {
+			return fmt.Errorf("%w: serial numbers must be non-empty and unique", ErrInvalidMovement)
+		}
+		seen[number] = true
+
+		serial := models.SerialNumber{ProductID: m.ProductID, Number: number, Status: models.SerialIssued}
+		if m.FromBinLocationID == nil {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&serial).Error; err != nil {
+				return err
+			}
+		}
+		if err := ForUpdate(tx).Where("product_id = ? AND number = ?", m.ProductID, number).First(&serial).Error; err != nil {
+			return fmt.Errorf("%w: serial %s not found for product %d", ErrInvalidMovement, number, m.ProductID)
+		}
+
+		if m.FromBinLocationID == nil {
+			if serial.Status == models.SerialInStock {
+				return fmt.Errorf("%w: serial %s is already in stock", ErrInvalidMovement, number)
+			}
+		} else if serial.Status != models.SerialInStock || serial.BinLocationID == nil || *serial.BinLocationID != *m.FromBinLocationID {
+			return fmt.Errorf("%w: serial %s is not in bin location %d", ErrInvalidMovement, number, *m.FromBinLocationID)
+		}
+		m.Serials = append(m.Serials, serial)
+	}
+	return nil
+}
+
+// moveSerials records the serials of a posted movement at their new location
+func moveSerials(tx *gorm.DB, m *models.StockMovement) error {
+	if len(m.Serials) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(m.Serials))
+	for _, serial := range m.Serials {
+		ids = append(ids, serial.ID)
+	}
+	updates := map[string]interface{}{"status": models.SerialIssued, "bin_location_id": nil}
+	if m.ToBinLocationID != nil {
+		updates = map[string]interface{}{"status": models.SerialInStock, "bin_location_id": *m.ToBinLocationID}
+	}
+	if err := tx.Model(&models.SerialNumber{}).Where("id IN ?", ids).Updates(updates).Error; err != nil {
+		return err
+	}
+	for i := range m.Serials {
+		m.Serials[i].Status = updates["status"].(string)
+		m.Serials[i].BinLocationID = m.ToBinLocationID
+	}
+	return nil
+}
+
+// decrement lowers a stock level, refusing to go below zero or to take
+// reserved units. The check and the update happen in a single statement so
+// concurrent movements cannot both consume the same units.
+func decrement(tx *gorm.DB, productID, binID, lotID uint, qty float64) error {
+	result := tx.Model(&models.StockLevel{}).
+		Where("product_id = ? AND bin_location_id = ? AND lot_id = ? AND quantity - reserved >= ?", productID, binID, lotID, qty).
+		Update("quantity", gorm.Expr("quantity - ?", qty))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+// increment raises a stock level, creating it on first use
+func increment(tx *gorm.DB, productID, binID, lotID uint, qty float64) error {
+	level := models.StockLevel{ProductID: productID, BinLocationID: binID, LotID: lotID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&level).Error; err != nil {
+		return err
+	}
+
+	result := tx.Model(&models.StockLevel{}).
+		Where("product_id = ? AND bin_location_id = ? AND lot_id = ?", productID, binID, lotID).
+		Update("quantity", gorm.Expr("quantity + ?", qty))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("stock level of product %d in bin %d (lot %d) could not be created", productID, binID, lotID)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// inventory/replenishment.go
+package inventory
+
+import (
+	"github.com/aldhipradana/warehouse-api/models"
+	"gorm.io/gorm"
+)
+
+// Suggestion is the replenishment need of one product in one warehouse
+type Suggestion struct {
+	ProductID         uint    `json:"product_id"`
+	ProductName       string  `json:"product_name"`
+	WarehouseID       uint    `json:"warehouse_id"`
+	SupplierID        *uint   `json:"supplier_id"`
+	Method            string  `json:"method"`
+	OnHand            float64 `json:"on_hand"`
+	Reserved          float64 `json:"reserved"`
+	OnOrder           float64 `json:"on_order"`
+	InTransit         float64 `json:"in_transit"`
+	Position          float64 `json:"position"`
+	SuggestedQuantity float64 `json:"suggested_quantity"`
+}
+
+// openPurchaseStatuses are the purchase order statuses whose outstanding
+// quantity still counts as on order
+var openPurchaseStatuses = []string{
+	models.PurchaseOrderDraft,
+	models.PurchaseOrderSubmitted,
+	models.PurchaseOrderPartiallyReceived,
+}
+
+// Suggestions evaluates the reorder rules (of one warehouse, or all when
+// warehouseID is 0) against on-hand, reserved, open purchase order and
+// inbound in-transit quantities, and returns the products that need ordering.
+// On hand only counts bins whose stock can be reserved, so returns,
+// quarantine and staging bins are left out.
+func Suggestions(tx *gorm.DB, warehouseID uint) ([]Suggestion, error) {
+	query := tx.Preload("Product").Order("warehouse_id, product_id")
+	if warehouseID != 0 {
+		query = query.Where("warehouse_id = ?", warehouseID)
+	}
+	var rules []models.ReorderRule
+	if err := query.Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	suggestions := []Suggestion{}
+	for _, rule := range rules {
+		var stock struct {
+			Quantity  float64
+			Reserved  float64
+			InTransit float64
+		}
+		err := tx.Model(&models.StockLevel{}).
+			Select("COALESCE(SUM(CASE WHEN bin_locations.type IN ? THEN 0 ELSE stock_levels.quantity END), 0) AS quantity, "+
+				"COALESCE(SUM(CASE WHEN bin_locations.type IN ? THEN 0 ELSE stock_levels.reserved END), 0) AS reserved, "+
+				"COALESCE(SUM(CASE WHEN bin_locations.type = ? THEN stock_levels.quantity ELSE 0 END), 0) AS in_transit",
+				unreservedBinTypes, unreservedBinTypes, models.BinTypeTransit).
+			Joins("JOIN bin_locations ON bin_locations.id = stock_levels.bin_location_id").
+			Where("stock_levels.product_id = ? AND bin_locations.warehouse_id = ?", rule.ProductID, rule.WarehouseID).
+			Scan(&stock).Error
+		if err != nil {
+			return nil, err
+		}
+
+		var onOrder float64
+		err = tx.Model(&models.PurchaseOrderLine{}).
+			Select("COALESCE(SUM(CASE WHEN purchase_order_lines.quantity > purchase_order_lines.received_quantity "+
+				"THEN purchase_order_lines.quantity - purchase_order_lines.received_quantity ELSE 0 END), 0)").
+			Joins("JOIN purchase_orders ON purchase_orders.id = purchase_order_lines.purchase_order_id AND purchase_orders.deleted_at IS NULL").
+			Where("purchase_order_lines.product_id = ? AND purchase_orders.warehouse_id = ?", rule.ProductID, rule.WarehouseID).
+			Where("purchase_orders.status IN ?", openPurchaseStatuses).
+			Scan(&onOrder).Error
+		if err != nil {
+			return nil, err
+		}
+
+		position := stock.Quantity - stock.Reserved + onOrder + stock.InTransit
+		qty := rule.SuggestedQuantity(position)
+		if qty <= 0 {
+			continue
+		}
+
+		suggestion := Suggestion{
+			ProductID:         rule.ProductID,
+			WarehouseID:       rule.WarehouseID,
+			SupplierID:        rule.SupplierID,
+			Method:            rule.Method,
+			OnHand:            stock.Quantity,
+			Reserved:          stock.Reserved,
+			OnOrder:           onOrder,
+			InTransit:         stock.InTransit,
+			Position:          position,
+			SuggestedQuantity: qty,
+		}
+		if rule.Product != nil {
+			suggestion.ProductName = rule.Product.Name
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,257 @@
+// inventory/reservation.go
+package inventory
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/models"
+	"gorm.io/gorm"
+)
+
+// unreservedBinTypes are the bin types whose stock is never reserved: it
+// awaits a disposition, is in transit or is already staged for shipping
+var unreservedBinTypes = []string{models.BinTypeReturns, models.BinTypeQuarantine, models.BinTypeTransit, models.BinTypeStaging}
+
+// Reserve allocates qty of a product in a warehouse to a sales order line.
+// Candidate stock levels are locked before their available quantity is
+// read, so parallel confirms cannot promise the same units twice. Lots are
+// allocated first-expired-first-out; expired lots and stock in returns,
+// quarantine, in-transit or staging bins are skipped. It returns ErrInsufficientStock
+// when the warehouse cannot cover qty.
+func Reserve(tx *gorm.DB, line *models.SalesOrderLine, warehouseID uint, qty float64) error {
+	return reserve(tx, line, warehouseID, 0, qty)
+}
+
+// ReserveElsewhere is Reserve leaving out one bin, e.g. the bin a pick just
+// came up short in, whose recorded stock is not really there
+func ReserveElsewhere(tx *gorm.DB, line *models.SalesOrderLine, warehouseID, binID uint, qty float64) error {
+	return reserve(tx, line, warehouseID, binID, qty)
+}
+
+// ReserveElsewhereOrBackorder is ReserveElsewhere, recording qty as
+// backordered on the line when the warehouse cannot cover it. A partial
+// reservation is undone before backordering.
+func ReserveElsewhereOrBackorder(tx *gorm.DB, line *models.SalesOrderLine, warehouseID, binID uint, qty float64) error {
+	err := tx.Transaction(func(sp *gorm.DB) error {
+		return ReserveElsewhere(sp, line, warehouseID, binID, qty)
+	})
+	if errors.Is(err, ErrInsufficientStock) {
+		line.BackorderedQuantity += qty
+		return tx.Model(&models.SalesOrderLine{}).Where("id = ?", line.ID).
+			Update("backordered_quantity", gorm.Expr("backordered_quantity + ?", qty)).Error
+	}
+	return err
+}
+
+// Reallocate moves reservations off a stock level that is about to hold
+// only keep units, newest first, reserving them again in other bins of the
+// warehouse or backordering them
+func Reallocate(tx *gorm.DB, level *models.StockLevel, warehouseID uint, keep float64) error {
+	excess := level.Reserved - math.Max(keep, 0)
+	if excess <= 1e-9 {
+		return nil
+	}
+	var reservations []models.StockReservation
+	if err := ForUpdate(tx).Where("stock_level_id = ?", level.ID).Order("id DESC").Find(&reservations).Error; err != nil {
+		return err
+	}
+	for i := range reservations {
+		if excess <= 1e-9 {
+			break
+		}
+		reservation := &reservations[i]
+		take := math.Min(reservation.Quantity, excess)
+
+		var line models.SalesOrderLine
+		if err := ForUpdate(tx).First(&line, reservation.SalesOrderLineID).Error; err != nil {
+			return err
+		}
+		if err := Unreserve(tx, reservation, take); err != nil {
+			return err
+		}
+		line.ReservedQuantity -= take
+		if err := ReserveElsewhereOrBackorder(tx, &line, warehouseID, level.BinLocationID, take); err != nil {
+			return err
+		}
+		level.Reserved -= take
+		excess -= take
+	}
+	return nil
+}
+
+// reserve implements Reserve, skipping the bin skipBinID (0 for none)
+func reserve(tx *gorm.DB, line *models.SalesOrderLine, warehouseID, skipBinID uint, qty float64) error {
+	var levels []models.StockLevel
+	err := ForUpdate(tx).
+		Where("product_id = ? AND quantity > reserved AND bin_location_id <> ?", line.ProductID, skipBinID).
+		Where("bin_location_id IN (?)", tx.Model(&models.BinLocation{}).Select("id").
+			Where("warehouse_id = ? AND type NOT IN ?", warehouseID, unreservedBinTypes)).
+		Order("id").
+		Find(&levels).Error
+	if err != nil {
+		return err
+	}
+	if err := sortFEFO(tx, levels); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	remaining := qty
+	for _, level := range levels {
+		if remaining <= 0 {
+			break
+		}
+		if level.Lot != nil && level.Lot.Expired(now) {
+			continue
+		}
+		take := math.Min(level.Available(), remaining)
+
+		result := tx.Model(&models.StockLevel{}).
+			Where("id = ? AND quantity - reserved >= ?", level.ID, take).
+			Update("reserved", gorm.Expr("reserved + ?", take))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientStock
+		}
+
+		reservation := models.StockReservation{
+			SalesOrderLineID: line.ID,
+			StockLevelID:     level.ID,
+			ProductID:        line.ProductID,
+			Quantity:         take,
+		}
+		if err := tx.Create(&reservation).Error; err != nil {
+			return err
+		}
+		remaining -= take
+	}
+
+	if remaining > 0 {
+		return ErrInsufficientStock
+	}
+
+	line.ReservedQuantity += qty
+	return tx.Model(&models.SalesOrderLine{}).Where("id = ?", line.ID).
+		Update("reserved_quantity", gorm.Expr("reserved_quantity + ?", qty)).Error
+}
+
+// Release frees every reservation held by a sales order line
+func Release(tx *gorm.DB, line *models.SalesOrderLine) error {
+	var reservations []models.StockReservation
+	if err := tx.Where("sales_order_line_id = ?", line.ID).Find(&reservations).Error; err != nil {
+		return err
+	}
+
+	for _, reservation := range reservations {
+		if err := tx.Model(&models.StockLevel{}).Where("id = ?", reservation.StockLevelID).
+			Update("reserved", gorm.Expr("reserved - ?", reservation.Quantity)).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&reservation).Error; err != nil {
+			return err
+		}
+	}
+
+	line.ReservedQuantity = 0
+	return tx.Model(line).Update("reserved_quantity", 0).Error
+}
+
+// ReserveInBin reserves qty of the line's product (and lot, 0 for none) on the
+// stock level of a specific bin, e.g. a staging bin the goods were just picked to
+func ReserveInBin(tx *gorm.DB, line *models.SalesOrderLine, binID, lotID uint, qty float64) error {
+	var level models.StockLevel
+	if err := ForUpdate(tx).Where("product_id = ? AND bin_location_id = ? AND lot_id = ?", line.ProductID, binID, lotID).First(&level).Error; err != nil {
+		return ErrInsufficientStock
+	}
+
+	result := tx.Model(&models.StockLevel{}).
+		Where("id = ? AND quantity - reserved >= ?", level.ID, qty).
+		Update("reserved", gorm.Expr("reserved + ?", qty))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+
+	reservation := models.StockReservation{
+		SalesOrderLineID: line.ID,
+		StockLevelID:     level.ID,
+		ProductID:        line.ProductID,
+		Quantity:         qty,
+	}
+	if err := tx.Create(&reservation).Error; err != nil {
+		return err
+	}
+
+	line.ReservedQuantity += qty
+	return tx.Model(&models.SalesOrderLine{}).Where("id = ?", line.ID).
+		Update("reserved_quantity", gorm.Expr("reserved_quantity + ?", qty)).Error
+}
+
+// Unreserve hands qty of a single reservation back to available stock,
+// deleting the reservation once it is fully consumed
+func Unreserve(tx *gorm.DB, reservation *models.StockReservation, qty float64) error {
+	if qty > reservation.Quantity {
+		return ErrInsufficientStock
+	}
+
+	if err := tx.Model(&models.StockLevel{}).Where("id = ?", reservation.StockLevelID).
+		Update("reserved", gorm.Expr("reserved - ?", qty)).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.SalesOrderLine{}).Where("id = ?", reservation.SalesOrderLineID).
+		Update("reserved_quantity", gorm.Expr("reserved_quantity - ?", qty)).Error; err != nil {
+		return err
+	}
+
+	reservation.Quantity -= qty
+	if reservation.Quantity <= 0 {
+		return tx.Delete(reservation).Error
+	}
+	return tx.Model(reservation).Update("quantity", reservation.Quantity).Error
+}
+
+// sortFEFO loads the lots of the given stock levels and orders the levels by
+// lot expiry, earliest first. Levels without an expiry date go last and keep
+// their original order.
+func sortFEFO(tx *gorm.DB, levels []models.StockLevel) error {
+	lotIDs := []uint{}
+	for _, level := range levels {
+		if level.LotID != 0 {
+			lotIDs = append(lotIDs, level.LotID)
+		}
+	}
+	if len(lotIDs) == 0 {
+		return nil
+	}
+
+	var lots []models.Lot
+	if err := tx.Where("id IN ?", lotIDs).Find(&lots).Error; err != nil {
+		return err
+	}
+	byID := map[uint]*models.Lot{}
+	for i := range lots {
+		byID[lots[i].ID] = &lots[i]
+	}
+	for i := range levels {
+		levels[i].Lot = byID[levels[i].LotID]
+	}
+
+	sort.SliceStable(levels, func(i, j int) bool {
+		a, b := levels[i].Lot, levels[j].Lot
+		if a == nil || a.ExpiresAt == nil {
+			return false
+		}
+		if b == nil || b.ExpiresAt == nil {
+			return true
+		}
+		return a.ExpiresAt.Before(*b.ExpiresAt)
+	})
+	return nil
+}
@@ -0,0 +1,30 @@
+// inventory/transaction.go
+package inventory
+
+import (
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sqliteWriteLock serializes stock transactions on SQLite, which has no
+// row-level locking. Postgres and MySQL rely on SELECT ... FOR UPDATE instead.
+var sqliteWriteLock sync.Mutex
+
+// Transaction runs fn in a database transaction that is safe to use for
+// reading and then changing stock levels. On SQLite transactions are
+// serialized in-process so concurrent reservations cannot interleave.
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if db.Dialector.Name() == "sqlite" {
+		sqliteWriteLock.Lock()
+		defer sqliteWriteLock.Unlock()
+	}
+	return db.Transaction(fn)
+}
+
+// ForUpdate adds a row lock to the query. SQLite ignores the clause, which
+// is why stock transactions must go through Transaction.
+func ForUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
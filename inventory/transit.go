@@ -0,0 +1,83 @@
+// inventory/transit.go
+package inventory
+
+import (
+	"sort"
+
+	"github.com/aldhipradana/warehouse-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// transitCode is the zone and bin code of the virtual in-transit location
+const transitCode = "TRANSIT"
+
+// TransitBin returns the in-transit bin of a warehouse, creating it (in its
+// own zone) on first use
+func TransitBin(tx *gorm.DB, warehouseID uint) (uint, error) {
+	var bin models.BinLocation
+	err := tx.Where("warehouse_id = ? AND type = ?", warehouseID, models.BinTypeTransit).Order("id").Limit(1).Find(&bin).Error
+	if err != nil || bin.ID != 0 {
+		return bin.ID, err
+	}
+
+	zone := models.Zone{WarehouseID: warehouseID, Code: transitCode, Name: "In transit"}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&zone).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Where("warehouse_id = ? AND code = ?", warehouseID, transitCode).First(&zone).Error; err != nil {
+		return 0, err
+	}
+	bin = models.BinLocation{ZoneID: zone.ID, Code: transitCode, Type: models.BinTypeTransit}
+	if err := tx.Create(&bin).Error; err != nil {
+		return 0, err
+	}
+	return bin.ID, nil
+}
+
+// TransitLot is a quantity of one lot (LotID 0 for untracked products) a
+// transfer order still has in transit
+type TransitLot struct {
+	LotID    uint
+	Quantity float64
+}
+
+// TransitLots returns the lots of a product that a transfer order moved into
+// an in-transit bin and has not moved out again, oldest lot first
+func TransitLots(tx *gorm.DB, transferOrderID, productID, binID uint) ([]TransitLot, error) {
+	var rows []TransitLot
+	err := tx.Model(&models.StockMovement{}).
+		Select("COALESCE(lot_id, 0) AS lot_id, "+
+			"SUM(CASE WHEN to_bin_location_id = ? THEN quantity ELSE -quantity END) AS quantity", binID).
+		Where("reference_type = ? AND reference_id = ? AND product_id = ?", models.ReferenceTransferOrder, transferOrderID, productID).
+		Where("to_bin_location_id = ? OR from_bin_location_id = ?", binID, binID).
+		Group("COALESCE(lot_id, 0)").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	lots := rows[:0]
+	for _, row := range rows {
+		if row.Quantity > 1e-9 {
+			lots = append(lots, row)
+		}
+	}
+	sort.Slice(lots, func(i, j int) bool { return lots[i].LotID < lots[j].LotID })
+	return lots, nil
+}
+
+// TransitSerials returns the serial numbers of a product that a transfer
+// order moved into an in-transit bin and that are still there
+func TransitSerials(tx *gorm.DB, transferOrderID, productID, binID uint) ([]string, error) {
+	var numbers []string
+	err := tx.Model(&models.SerialNumber{}).
+		Where("product_id = ? AND status = ? AND bin_location_id = ?", productID, models.SerialInStock, binID).
+		Where("id IN (?)", tx.Table("stock_movement_serials").Select("stock_movement_serials.serial_number_id").
+			Joins("JOIN stock_movements ON stock_movements.id = stock_movement_serials.stock_movement_id").
+			Where("stock_movements.reference_type = ? AND stock_movements.reference_id = ? AND stock_movements.to_bin_location_id = ?",
+				models.ReferenceTransferOrder, transferOrderID, binID)).
+		Order("number").
+		Pluck("number", &numbers).Error
+	return numbers, err
+}
@@ -0,0 +1,283 @@
+// label/label.go
+package label
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/aldhipradana/warehouse-api/config"
+)
+
+// Label kinds, one per label endpoint
+const (
+	KindBin     = "bin"
+	KindProduct = "product"
+	KindPackage = "package"
+)
+
+// Barcode symbologies a label can carry
+const (
+	SymbologyCode128 = "code128"
+	SymbologyQR      = "qr"
+)
+
+// ErrUnknownTemplate is returned for template names that are not configured
+var ErrUnknownTemplate = errors.New("unknown label template")
+
+// defaultTemplates are used for any template not set in config.toml
+var defaultTemplates = map[string]config.LabelTemplate{
+	KindBin: {
+		Kind: KindBin, WidthMM: 100, HeightMM: 50, Symbology: SymbologyCode128,
+		Barcode: "{{.Code}}",
+		Lines:   []string{"{{.Code}}", "{{.Warehouse}} / {{.Zone}}"},
+	},
+	KindProduct: {
+		Kind: KindProduct, WidthMM: 60, HeightMM: 40, Symbology: SymbologyCode128,
+		Barcode: "{{.Barcode}}",
+		Lines:   []string{"{{.Name}}", "SKU {{.SKU}}"},
+	},
+	KindPackage: {
+		Kind: KindPackage, WidthMM: 100, HeightMM: 150, Symbology: SymbologyQR,
+		Barcode: "{{.TrackingNumber}}",
+		Lines: []string{
+			"{{.Customer}}",
+			"Order {{.Order}}",
+			"Shipment {{.Shipment}}",
+			"Package {{.Package}} of {{.Packages}}",
+			"{{.Carrier}} {{.Service}}",
+			"Tracking {{.TrackingNumber}}",
+		},
+	},
+}
+
+// Template is a parsed label template
+type Template struct {
+	Name      string  `json:"name"`
+	Kind      string  `json:"kind"`
+	WidthMM   float64 `json:"width_mm"`
+	HeightMM  float64 `json:"height_mm"`
+	Symbology string  `json:"symbology"`
+
+	barcode *template.Template
+	lines   []*template.Template
+}
+
+var (
+	dpi       = 203
+	templates = map[string]*Template{}
+)
+
+// Init parses the label templates of cfg on top of the built-in defaults
+func Init(cfg *config.Config) error {
+	if cfg.Labels.DPI > 0 {
+		dpi = cfg.Labels.DPI
+	}
+
+	merged := map[string]config.LabelTemplate{}
+	for name, tpl := range defaultTemplates {
+		merged[name] = tpl
+	}
+	for name, tpl := range cfg.Labels.Templates {
+		merged[name] = tpl
+	}
+
+	parsed := map[string]*Template{}
+	for name, tpl := range merged {
+		t, err := parseTemplate(name, tpl)
+		if err != nil {
+			return fmt.Errorf("label template %q: %w", name, err)
+		}
+		parsed[name] = t
+	}
+	templates = parsed
+	return nil
+}
+
+func parseTemplate(name string, tpl config.LabelTemplate) (*Template, error) {
+	switch tpl.Kind {
+	case KindBin, KindProduct, KindPackage:
+	default:
+		return nil, fmt.Errorf("kind must be bin, product or package, got %q", tpl.Kind)
+	}
+	switch tpl.Symbology {
+	case SymbologyCode128, SymbologyQR:
+	default:
+		return nil, fmt.Errorf("symbology must be code128 or qr, got %q", tpl.Symbology)
+	}
+	if tpl.WidthMM <= 0 || tpl.HeightMM <= 0 {
+		return nil, errors.New("width_mm and height_mm must be positive")
+	}
+
+	t := &Template{Name: name, Kind: tpl.Kind, WidthMM: tpl.WidthMM, HeightMM: tpl.HeightMM, Symbology: tpl.Symbology}
+	var err error
+	if t.barcode, err = template.New(name).Option("missingkey=zero").Parse(tpl.Barcode); err != nil {
+		return nil, err
+	}
+	for i, line := range tpl.Lines {
+		parsed, err := template.New(fmt.Sprintf("%s.%d", name, i)).Option("missingkey=zero").Parse(line)
+		if err != nil {
+			return nil, err
+		}
+		t.lines = append(t.lines, parsed)
+	}
+	return t, nil
+}
+
+// DPI returns the configured printer resolution in dots per inch
+func DPI() int {
+	return dpi
+}
+
+// Templates returns the configured templates sorted by name
+func Templates() []*Template {
+	list := make([]*Template, 0, len(templates))
+	for _, t := range templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Label is a template filled in with the data of one bin, product or package
+type Label struct {
+	WidthMM   float64
+	HeightMM  float64
+	Symbology string
+	Value     string
+	Lines     []string
+}
+
+// Render fills in the named template, which must be of the given kind
+func Render(name, kind string, data interface{}) (*Label, error) {
+	t, ok := templates[name]
+	if !ok || t.Kind != kind {
+		return nil, fmt.Errorf("%w: no %s template named %q", ErrUnknownTemplate, kind, name)
+	}
+
+	execute := func(tpl *template.Template) (string, error) {
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, data); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(buf.String()), nil
+	}
+
+	value, err := execute(t.barcode)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, fmt.Errorf("%w: the barcode of template %q is empty", ErrUnencodable, name)
+	}
+	l := &Label{WidthMM: t.WidthMM, HeightMM: t.HeightMM, Symbology: t.Symbology, Value: value}
+	for _, line := range t.lines {
+		text, err := execute(line)
+		if err != nil {
+			return nil, err
+		}
+		l.Lines = append(l.Lines, text)
+	}
+	return l, nil
+}
+
+// rect is a filled rectangle in dots
+type rect struct {
+	x, y, w, h int
+}
+
+// textLine is a line of text in dots; y is the top of the line
+type textLine struct {
+	x, y, size int
+	text       string
+}
+
+// layout is a label laid out for a printer resolution, shared by all
+// output formats so PNG, PDF and ZPL labels look the same
+type layout struct {
+	width, height int
+	text          []textLine
+	bars          []rect
+	// barcode position and module size, used by ZPL's native barcode commands
+	barcodeX, barcodeY, barcodeHeight, module int
+}
+
+// maxModule is the widest bar or QR module in dots; ZPL barcode commands
+// accept at most 10
+const maxModule = 10
+
+// mmToDots converts millimetres to printer dots
+func mmToDots(mm float64, dpi int) int {
+	return int(mm/25.4*float64(dpi) + 0.5)
+}
+
+// layout places the text lines at the top of the label and the barcode,
+// as large as fits, centered below them
+func (l *Label) layout(dpi int) (*layout, error) {
+	lo := &layout{width: mmToDots(l.WidthMM, dpi), height: mmToDots(l.HeightMM, dpi)}
+	margin := mmToDots(2, dpi)
+	size := max(min(lo.height/12, mmToDots(5, dpi)), 8)
+	if len(l.Lines) > 6 {
+		size = max(lo.height/(2*len(l.Lines)), 8)
+	}
+
+	y := margin
+	for _, text := range l.Lines {
+		lo.text = append(lo.text, textLine{x: margin, y: y, size: size, text: text})
+		y += size * 5 / 4
+	}
+	if len(l.Lines) > 0 {
+		y += margin
+	}
+	width, height := lo.width-2*margin, lo.height-y-margin
+
+	switch l.Symbology {
+	case SymbologyQR:
+		modules, err := EncodeQR(l.Value)
+		if err != nil {
+			return nil, err
+		}
+		n := len(modules) + 8 // four module quiet zone on each side
+		lo.module = min(min(width, height)/n, maxModule)
+		if lo.module < 1 {
+			return nil, fmt.Errorf("%w: the QR code does not fit on the label", ErrUnencodable)
+		}
+		x0 := margin + (width-len(modules)*lo.module)/2
+		y0 := y + 4*lo.module
+		lo.barcodeX, lo.barcodeY, lo.barcodeHeight = x0, y0, len(modules)*lo.module
+		for row, line := range modules {
+			for col, dark := range line {
+				if dark {
+					lo.bars = append(lo.bars, rect{x0 + col*lo.module, y0 + row*lo.module, lo.module, lo.module})
+				}
+			}
+		}
+	default:
+		modules, err := EncodeCode128(l.Value)
+		if err != nil {
+			return nil, err
+		}
+		n := len(modules) + 20 // ten module quiet zone on each side
+		lo.module = min(width/n, maxModule)
+		if lo.module < 1 || height < mmToDots(5, dpi) {
+			return nil, fmt.Errorf("%w: the barcode does not fit on the label", ErrUnencodable)
+		}
+		x0 := margin + (width-len(modules)*lo.module)/2
+		lo.barcodeX, lo.barcodeY, lo.barcodeHeight = x0, y, height
+		for i := 0; i < len(modules); {
+			if !modules[i] {
+				i++
+				continue
+			}
+			start := i
+			for i < len(modules) && modules[i] {
+				i++
+			}
+			lo.bars = append(lo.bars, rect{x0 + start*lo.module, y, (i - start) * lo.module, height})
+		}
+	}
+	return lo, nil
+}
@@ -0,0 +1,74 @@
+// label/pdf.go
+package label
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// PDF renders the label as a single page PDF of the label size. Bars are
+// drawn as vectors in the printer layout, text uses the built-in Helvetica font.
+func (l *Label) PDF() ([]byte, error) {
+	lo, err := l.layout(dpi)
+	if err != nil {
+		return nil, err
+	}
+
+	// PDF units are points (1/72 inch) with the origin at the bottom left
+	scale := 72 / float64(dpi)
+	width, height := float64(lo.width)*scale, float64(lo.height)*scale
+
+	var content bytes.Buffer
+	content.WriteString("0 g\n")
+	for _, bar := range lo.bars {
+		fmt.Fprintf(&content, "%.2f %.2f %.2f %.2f re f\n",
+			float64(bar.x)*scale, height-float64(bar.y+bar.h)*scale, float64(bar.w)*scale, float64(bar.h)*scale)
+	}
+	for _, line := range lo.text {
+		size := float64(line.size) * scale
+		fmt.Fprintf(&content, "BT /F1 %.2f Tf %.2f %.2f Td (%s) Tj ET\n",
+			size, float64(line.x)*scale, height-float64(line.y)*scale-size*0.8, pdfString(line.text))
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>", width, height),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes(), nil
+}
+
+// pdfString escapes text for a PDF literal string, replacing characters
+// outside printable ASCII
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteRune('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+// label/png.go
+package label
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// PNG renders the label as a black and white image at the configured resolution
+func (l *Label) PNG() ([]byte, error) {
+	lo, err := l.layout(dpi)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewGray(image.Rect(0, 0, lo.width, lo.height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	fill := func(r rect) {
+		for y := max(r.y, 0); y < min(r.y+r.h, lo.height); y++ {
+			for x := max(r.x, 0); x < min(r.x+r.w, lo.width); x++ {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			}
+		}
+	}
+
+	for _, bar := range lo.bars {
+		fill(bar)
+	}
+	for _, line := range lo.text {
+		// Glyphs are 5x7 in an 6x8 cell, scaled to the line size
+		scale := max(line.size/8, 1)
+		x := line.x
+		for _, r := range line.text {
+			if x+5*scale > lo.width {
+				break
+			}
+			columns := glyph(r)
+			for col, bits := range columns {
+				for row := 0; row < 7; row++ {
+					if bits&(1<<row) != 0 {
+						fill(rect{x + col*scale, line.y + row*scale, scale, scale})
+					}
+				}
+			}
+			x += 6 * scale
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
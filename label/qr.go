@@ -0,0 +1,438 @@
+// label/qr.go
+package label
+
+import "fmt"
+
+// QR codes are encoded in byte mode with error correction level M, which
+// survives roughly 15% damage and is what most label printers default to.
+// The tables below are the level M rows of ISO/IEC 18004, indexed by version.
+var (
+	qrECCodewordsPerBlock = [41]int{-1,
+		10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26,
+		26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28}
+	qrECBlocks = [41]int{-1,
+		1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16,
+		17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49}
+)
+
+// qrFormatLevelM is the two-bit error correction level written into the format information
+const qrFormatLevelM = 0
+
+// qrCode is a QR symbol under construction
+type qrCode struct {
+	version    int
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// EncodeQR encodes data as a QR code and returns its modules row by row,
+// true for a dark module. The smallest version that fits is used and the
+// quiet zone is not included.
+func EncodeQR(data string) ([][]bool, error) {
+	payload := []byte(data)
+
+	version := 0
+	for v := 1; v <= 40; v++ {
+		if 4+qrCountBits(v)+len(payload)*8 <= qrDataCodewords(v)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("%w: %d bytes do not fit in a QR code", ErrUnencodable, len(payload))
+	}
+
+	// Byte mode indicator, character count and the data itself
+	var bits qrBits
+	bits.append(0x4, 4)
+	bits.append(len(payload), qrCountBits(version))
+	for _, b := range payload {
+		bits.append(int(b), 8)
+	}
+
+	// Terminator, byte alignment and alternating pad bytes
+	capacity := qrDataCodewords(version) * 8
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+
+	qr := newQRCode(version)
+	qr.drawFunctionPatterns()
+	qr.drawCodewords(qr.addErrorCorrection(codewords))
+
+	// Keep the mask with the lowest penalty score
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		if penalty := qr.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask) // masking is its own inverse
+	}
+	qr.applyMask(best)
+	qr.drawFormatBits(best)
+
+	return qr.modules, nil
+}
+
+// qrBits is a growable bit string
+type qrBits []bool
+
+// append adds the n lowest bits of v, most significant first
+func (b *qrBits) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (v>>i)&1 == 1)
+	}
+}
+
+// qrCountBits is the length of the byte mode character count for a version
+func qrCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// qrRawModules is the number of modules available for data and error
+// correction after the function patterns of a version are drawn
+func qrRawModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		result -= (25*align-10)*align - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// qrDataCodewords is the number of data codewords a version holds at level M
+func qrDataCodewords(version int) int {
+	return qrRawModules(version)/8 - qrECCodewordsPerBlock[version]*qrECBlocks[version]
+}
+
+func newQRCode(version int) *qrCode {
+	size := version*4 + 17
+	qr := &qrCode{version: version, size: size}
+	qr.modules = make([][]bool, size)
+	qr.isFunction = make([][]bool, size)
+	for y := range qr.modules {
+		qr.modules[y] = make([]bool, size)
+		qr.isFunction[y] = make([]bool, size)
+	}
+	return qr
+}
+
+func (qr *qrCode) setFunction(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.isFunction[y][x] = true
+}
+
+// drawFunctionPatterns draws the timing, finder, alignment and version
+// patterns and reserves the format information area
+func (qr *qrCode) drawFunctionPatterns() {
+	for i := 0; i < qr.size; i++ {
+		qr.setFunction(6, i, i%2 == 0)
+		qr.setFunction(i, 6, i%2 == 0)
+	}
+
+	for _, corner := range [][2]int{{3, 3}, {qr.size - 4, 3}, {3, qr.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := corner[0]+dx, corner[1]+dy
+				if x >= 0 && x < qr.size && y >= 0 && y < qr.size {
+					dist := max(abs(dx), abs(dy))
+					qr.setFunction(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+
+	positions := qr.alignmentPositions()
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Skip the three corners taken by finder patterns
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	qr.drawFormatBits(0)
+	qr.drawVersion()
+}
+
+// alignmentPositions returns the row/column centers of the alignment patterns
+func (qr *qrCode) alignmentPositions() []int {
+	if qr.version == 1 {
+		return nil
+	}
+	count := qr.version/7 + 2
+	step := (qr.version*8 + count*3 + 5) / (count*4 - 4) * 2
+	positions := make([]int, count)
+	positions[0] = 6
+	for i, pos := count-1, qr.size-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// drawFormatBits writes both copies of the error correction level and mask
+func (qr *qrCode) drawFormatBits(mask int) {
+	data := qrFormatLevelM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunction(8, i, bit(i))
+	}
+	qr.setFunction(8, 7, bit(6))
+	qr.setFunction(8, 8, bit(7))
+	qr.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		qr.setFunction(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunction(8, qr.size-15+i, bit(i))
+	}
+	qr.setFunction(8, qr.size-8, true) // always dark
+}
+
+// drawVersion writes both copies of the version information (version 7 and up)
+func (qr *qrCode) drawVersion() {
+	if qr.version < 7 {
+		return
+	}
+	rem := qr.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := qr.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 == 1
+		a, b := qr.size-11+i%3, i/3
+		qr.setFunction(a, b, dark)
+		qr.setFunction(b, a, dark)
+	}
+}
+
+// addErrorCorrection splits the data into blocks, appends the Reed-Solomon
+// codewords of each block and interleaves the result
+func (qr *qrCode) addErrorCorrection(data []byte) []byte {
+	blocks := qrECBlocks[qr.version]
+	eccLen := qrECCodewordsPerBlock[qr.version]
+	raw := qrRawModules(qr.version) / 8
+	shortBlocks := blocks - raw%blocks
+	shortLen := raw / blocks
+
+	divisor := reedSolomonDivisor(eccLen)
+	var all [][]byte
+	for i, k := 0, 0; i < blocks; i++ {
+		n := shortLen - eccLen
+		if i >= shortBlocks {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < shortBlocks {
+			block = append(block, 0) // placeholder, skipped when interleaving
+		}
+		all = append(all, append(block, ecc...))
+	}
+
+	result := make([]byte, 0, raw)
+	for i := range all[0] {
+		for j, block := range all {
+			if i != shortLen-eccLen || j >= shortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// drawCodewords places the codewords in the zigzag pattern, two columns at
+// a time from the bottom right corner, skipping function modules
+func (qr *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		for vert := 0; vert < qr.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = qr.size - 1 - vert
+				}
+				if !qr.isFunction[y][x] && i < len(data)*8 {
+					qr.modules[y][x] = (data[i>>3]>>(7-i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by one of the eight mask patterns
+func (qr *qrCode) applyMask(mask int) {
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !qr.isFunction[y][x] {
+				qr.modules[y][x] = !qr.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to read: long runs, 2x2 blocks,
+// finder-like patterns and an unbalanced share of dark modules
+func (qr *qrCode) penalty() int {
+	result := 0
+	at := func(x, y int, horizontal bool) bool {
+		if horizontal {
+			return qr.modules[y][x]
+		}
+		return qr.modules[x][y]
+	}
+
+	for _, horizontal := range []bool{true, false} {
+		for y := 0; y < qr.size; y++ {
+			run := 1
+			for x := 1; x <= qr.size; x++ {
+				if x < qr.size && at(x, y, horizontal) == at(x-1, y, horizontal) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += 3 + run - 5
+				}
+				run = 1
+			}
+
+			// 1:1:3:1:1 finder-like pattern with four light modules on either side
+			for x := 0; x+11 <= qr.size; x++ {
+				var pattern [11]bool
+				for k := range pattern {
+					pattern[k] = at(x+k, y, horizontal)
+				}
+				if pattern == [11]bool{true, false, true, true, true, false, true, false, false, false, false} ||
+					pattern == [11]bool{false, false, false, false, true, false, true, true, true, false, true} {
+					result += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if qr.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := qr.modules[y][x]
+				if c == qr.modules[y][x-1] && c == qr.modules[y-1][x] && c == qr.modules[y-1][x-1] {
+					result += 3
+				}
+			}
+		}
+	}
+	total := qr.size * qr.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return result + max(k, 0)*10
+}
+
+// reedSolomonDivisor returns the generator polynomial of the given degree
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// reedSolomonRemainder returns the error correction codewords for data
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies two elements of GF(2^8) modulo x^8+x^4+x^3+x^2+1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -4,8 +4,11 @@ import (
 	"log"
 
 	"github.com/aldhipradana/warehouse-api/config"
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/label"
 	"github.com/aldhipradana/warehouse-api/middleware"
 	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
 	"github.com/aldhipradana/warehouse-api/routes"
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/mysql"
@@ -43,8 +46,75 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	db.AutoMigrate(&models.Product{}, &models.User{})
+	if err := models.MigrateProductPrices(db); err != nil {
+		log.Fatalf("Failed to migrate product prices: %v", err)
+	}
+	if err := models.MigrateProductCodes(db); err != nil {
+		log.Fatalf("Failed to migrate product codes: %v", err)
+	}
+	if err := models.MigrateStockLevelKey(db); err != nil {
+		log.Fatalf("Failed to migrate stock level key: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.UnitOfMeasure{},
+		&models.Attribute{},
+		&models.AttributeValue{},
+		&models.Category{},
+		&models.Product{},
+		&models.ProductUnit{},
+		&models.Barcode{},
+		&models.User{},
+		&models.Warehouse{},
+		&models.Zone{},
+		&models.BinLocation{},
+		&models.Lot{},
+		&models.SerialNumber{},
+		&models.StockLevel{},
+		&models.StockMovement{},
+		&models.Sequence{},
+		&models.Supplier{},
+		&models.PurchaseOrder{},
+		&models.PurchaseOrderLine{},
+		&models.CustomerGroup{},
+		&models.Customer{},
+		&models.SalesOrder{},
+		&models.SalesOrderLine{},
+		&models.StockReservation{},
+		&models.Wave{},
+		&models.PickList{},
+		&models.PickListLine{},
+		&models.Shipment{},
+		&models.Package{},
+		&models.PackageLine{},
+		&models.CountSession{},
+		&models.CountLine{},
+		&models.ReorderRule{},
+		&models.BOMLine{},
+		&models.WorkOrder{},
+		&models.WorkOrderLine{},
+		&models.ReturnAuthorization{},
+		&models.ReturnLine{},
+		&models.ReturnReceipt{},
+		&models.TransferOrder{},
+		&models.TransferOrderLine{},
+		&models.CostLayer{},
+		&models.PriceList{},
+		&models.PriceListItem{},
+		&models.ExchangeRate{},
+	); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
 	middleware.InitAuth(cfg)
+	restful.SetCursorSecret(cfg.JWT.Secret)
+	if err := label.Init(cfg); err != nil {
+		log.Fatalf("Failed to load label templates: %v", err)
+	}
+	if err := inventory.SetCostingMethod(cfg.Inventory.CostingMethod); err != nil {
+		log.Fatalf("Invalid inventory configuration: %v", err)
+	}
+	if err := inventory.MigrateOpeningCosts(db); err != nil {
+		log.Fatalf("Failed to migrate opening costs: %v", err)
+	}
 
 	r := gin.Default()
 	r.Use(middleware.ActionLogger())
@@ -98,3 +98,10 @@ func AdminMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// CurrentUserID returns the ID of the authenticated user set by AuthMiddleware
+func CurrentUserID(c *gin.Context) uint {
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(uint)
+	return id
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// Permissions that unlock actions beyond a role's normal access
+const (
+	// PermissionIssueExpired allows issuing stock from an expired lot
+	PermissionIssueExpired = "stock.issue_expired"
+	// PermissionViewCountedStock allows reading stock levels while a count
+	// session is open, which counters may not so their counts stay blind
+	PermissionViewCountedStock = "stock.view_counted"
+)
+
+// rolePermissions lists the extra permissions granted to each role
+var rolePermissions = map[string][]string{
+	"admin":   {PermissionIssueExpired, PermissionViewCountedStock},
+	"manager": {PermissionIssueExpired, PermissionViewCountedStock},
+}
+
+// HasPermission reports whether the authenticated user's role grants permission
+func HasPermission(c *gin.Context, permission string) bool {
+	role, _ := c.Get("user_role")
+	name, _ := role.(string)
+	for _, p := range rolePermissions[name] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package models
+
+import "gorm.io/gorm"
+
+// Attribute is a dimension products vary by, e.g. size or color
+type Attribute struct {
+	gorm.Model
+	Code   string           `json:"code" gorm:"size:32;uniqueIndex;not null"`
+	Name   string           `json:"name"`
+	Values []AttributeValue `json:"values,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (Attribute) GetSearchableFields() []string {
+	return []string{"code", "name"}
+}
+
+// AttributeValue is one option of an attribute, e.g. "M" for size
+type AttributeValue struct {
+	gorm.Model
+	AttributeID uint       `json:"attribute_id" gorm:"not null;uniqueIndex:idx_attribute_value"`
+	Value       string     `json:"value" gorm:"size:64;not null;uniqueIndex:idx_attribute_value"`
+	Position    int        `json:"position" gorm:"not null;default:0"`
+	Attribute   *Attribute `json:"attribute,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (AttributeValue) GetSearchableFields() []string {
+	return []string{"value"}
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Barcode symbologies
+const (
+	BarcodeEAN13    = "ean13"
+	BarcodeUPCA     = "upca"
+	BarcodeCode128  = "code128"
+	BarcodeInternal = "internal"
+)
+
+// ErrInvalidBarcode is returned when a code does not match its symbology
+var ErrInvalidBarcode = errors.New("invalid barcode")
+
+// Barcode is one of the scannable codes of a product. Codes are unique
+// across all products so a scan resolves to a single product.
+type Barcode struct {
+	gorm.Model
+	ProductID uint     `json:"product_id" gorm:"not null;index"`
+	Code      string   `json:"code" gorm:"size:64;uniqueIndex;not null"`
+	Type      string   `json:"type" gorm:"size:16;not null"`
+	Product   *Product `json:"product,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (Barcode) GetSearchableFields() []string {
+	return []string{"code", "type"}
+}
+
+// BeforeSave is a GORM hook that numbers new internal barcodes created
+// without a code, detects the symbology when it is left empty and
+// validates the code and its check digit
+func (b *Barcode) BeforeSave(tx *gorm.DB) error {
+	b.Code = strings.TrimSpace(b.Code)
+	if b.Code == "" && b.ID == 0 && b.Type == BarcodeInternal {
+		number, err := NextNumber(tx, "INT")
+		if err != nil {
+			return err
+		}
+		b.Code = strings.ReplaceAll(number, "-", "")
+	}
+	if b.Type == "" {
+		b.Type = DetectBarcodeType(b.Code)
+	}
+	if err := ValidateBarcode(b.Type, b.Code); err != nil {
+		return err
+	}
+	tx.Statement.SetColumn("Code", b.Code)
+	tx.Statement.SetColumn("Type", b.Type)
+	return nil
+}
+
+// DetectBarcodeType guesses the symbology of a code from its length and characters
+func DetectBarcodeType(code string) string {
+	switch {
+	case len(code) == 13 && isDigits(code):
+		return BarcodeEAN13
+	case len(code) == 12 && isDigits(code):
+		return BarcodeUPCA
+	default:
+		return BarcodeCode128
+	}
+}
+
+// ValidateBarcode checks that code is valid for the symbology typ
+func ValidateBarcode(typ, code string) error {
+	switch typ {
+	case BarcodeEAN13, BarcodeUPCA:
+		length := 13
+		if typ == BarcodeUPCA {
+			length = 12
+		}
+		if len(code) != length || !isDigits(code) {
+			return fmt.Errorf("%w: %s needs exactly %d digits", ErrInvalidBarcode, typ, length)
+		}
+		if want := gtinCheckDigit(code[:length-1]); code[length-1] != want {
+			return fmt.Errorf("%w: check digit of %s should be %c", ErrInvalidBarcode, code, want)
+		}
+	case BarcodeCode128:
+		if code == "" || len(code) > 64 {
+			return fmt.Errorf("%w: code128 needs 1 to 64 characters", ErrInvalidBarcode)
+		}
+		for _, r := range code {
+			if r < 32 || r > 126 {
+				return fmt.Errorf("%w: code128 only encodes printable ASCII", ErrInvalidBarcode)
+			}
+		}
+	case BarcodeInternal:
+		if code == "" || len(code) > 64 {
+			return fmt.Errorf("%w: internal codes need 1 to 64 characters", ErrInvalidBarcode)
+		}
+		for _, r := range code {
+			if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r == '-') {
+				return fmt.Errorf("%w: internal codes only use digits, capital letters and dashes", ErrInvalidBarcode)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q, expected ean13, upca, code128 or internal", ErrInvalidBarcode, typ)
+	}
+	return nil
+}
+
+// gtinCheckDigit computes the GS1 check digit for the digits before it.
+// Weights alternate 3 and 1 starting from the rightmost digit, which covers
+// both EAN-13 and UPC-A.
+func gtinCheckDigit(digits string) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
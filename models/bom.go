@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"math"
+
+	"gorm.io/gorm"
+)
+
+// BOMLine is one component of a kit or assembled product: Quantity units of
+// the component go into one unit of the product. A product with BOM lines is
+// a kit; it can be assembled and disassembled with work orders and its
+// availability is derived from its components.
+type BOMLine struct {
+	gorm.Model
+	ProductID   uint     `json:"product_id" gorm:"not null;uniqueIndex:idx_bom_line"`
+	ComponentID uint     `json:"component_id" gorm:"not null;uniqueIndex:idx_bom_line"`
+	Quantity    float64  `json:"quantity" gorm:"not null"`
+	Product     *Product `json:"product,omitempty"`
+	Component   *Product `json:"component,omitempty" gorm:"foreignKey:ComponentID"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (BOMLine) GetSearchableFields() []string {
+	return []string{}
+}
+
+// BeforeSave is a GORM hook that validates the quantity and keeps the bill
+// of materials free of loops
+func (b *BOMLine) BeforeSave(tx *gorm.DB) error {
+	if b.Quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+	if b.ComponentID == b.ProductID {
+		return errors.New("a product cannot be a component of itself")
+	}
+
+	db := tx.Session(&gorm.Session{NewDB: true})
+	var product, component Product
+	if err := db.First(&product, b.ProductID).Error; err != nil {
+		return errors.New("product not found")
+	}
+	if err := db.First(&component, b.ComponentID).Error; err != nil {
+		return errors.New("component not found")
+	}
+	if !component.Divisible && b.Quantity != math.Trunc(b.Quantity) {
+		return errors.New("the component is not divisible, quantity must be a whole number")
+	}
+
+	// Walk down from the component; reaching the product would close a loop
+	seen := map[uint]bool{}
+	queue := []uint{b.ComponentID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == b.ProductID {
+			return errors.New("the component contains the product, which would create a loop")
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		var children []uint
+		if err := db.Model(&BOMLine{}).Where("product_id = ?", id).Pluck("component_id", &children).Error; err != nil {
+			return err
+		}
+		queue = append(queue, children...)
+	}
+	return nil
+}
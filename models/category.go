@@ -0,0 +1,117 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Category groups products in a tree. Path holds the IDs from the root down
+// to the category itself, e.g. "1/5/12/", so a subtree is a prefix match.
+type Category struct {
+	gorm.Model
+	Name     string     `json:"name" gorm:"not null"`
+	ParentID *uint      `json:"parent_id" gorm:"index"`
+	Path     string     `json:"path" gorm:"size:255;index"`
+	Depth    int        `json:"depth" gorm:"not null;default:1"`
+	Parent   *Category  `json:"parent,omitempty"`
+	Children []Category `json:"children,omitempty" gorm:"foreignKey:ParentID"`
+
+	// previousPath is the stored path before the save, used to move the subtree
+	previousPath string
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (Category) GetSearchableFields() []string {
+	return []string{"name", "path"}
+}
+
+// AncestorIDs returns the IDs on the path from the root down to the category
+func (c Category) AncestorIDs() []uint {
+	var ids []uint
+	for _, part := range strings.Split(strings.TrimSuffix(c.Path, "/"), "/") {
+		if id, err := strconv.ParseUint(part, 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// BeforeSave is a GORM hook that rejects missing parents and moves that
+// would put a category below itself
+func (c *Category) BeforeSave(tx *gorm.DB) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	c.previousPath = ""
+	if c.ID != 0 {
+		var stored Category
+		if err := db.Select("path").First(&stored, c.ID).Error; err == nil {
+			c.previousPath = stored.Path
+		}
+	}
+	if c.ParentID == nil {
+		return nil
+	}
+
+	if *c.ParentID == c.ID {
+		return errors.New("a category cannot be its own parent")
+	}
+	var parent Category
+	if err := db.First(&parent, *c.ParentID).Error; err != nil {
+		return errors.New("parent category not found")
+	}
+	if c.previousPath != "" && strings.HasPrefix(parent.Path, c.previousPath) {
+		return errors.New("a category cannot be moved below one of its own descendants")
+	}
+	return nil
+}
+
+// AfterSave is a GORM hook that recalculates the path and depth of the
+// category and, when it moved, of every category below it
+func (c *Category) AfterSave(tx *gorm.DB) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	path := fmt.Sprintf("%d/", c.ID)
+	if c.ParentID != nil {
+		var parent Category
+		if err := db.Select("path").First(&parent, *c.ParentID).Error; err != nil {
+			return err
+		}
+		path = parent.Path + path
+	}
+
+	c.Path, c.Depth = path, strings.Count(path, "/")
+	if err := db.Model(&Category{}).Where("id = ?", c.ID).
+		UpdateColumns(map[string]interface{}{"path": c.Path, "depth": c.Depth}).Error; err != nil {
+		return err
+	}
+	if c.previousPath == "" || c.previousPath == path {
+		return nil
+	}
+
+	var descendants []Category
+	if err := db.Where("path LIKE ? AND id <> ?", c.previousPath+"%", c.ID).Find(&descendants).Error; err != nil {
+		return err
+	}
+	for _, d := range descendants {
+		moved := path + strings.TrimPrefix(d.Path, c.previousPath)
+		if err := db.Model(&Category{}).Where("id = ?", d.ID).
+			UpdateColumns(map[string]interface{}{"path": moved, "depth": strings.Count(moved, "/")}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DescendantsFilter restricts column to the category with the given ID and
+// every category below it. It backs the "descendants" filter function.
+func DescendantsFilter(db *gorm.DB, column clause.Column, value interface{}) *gorm.DB {
+	var root Category
+	if err := db.Session(&gorm.Session{NewDB: true}).Select("path").First(&root, "id = ?", value).Error; err != nil {
+		return db.Where("1 = 0")
+	}
+	return db.Where("? IN (?)", column, db.Session(&gorm.Session{NewDB: true}).
+		Model(&Category{}).Select("id").Where("path LIKE ?", root.Path+"%"))
+}
@@ -0,0 +1,16 @@
+package models
+
+import "gorm.io/gorm"
+
+// CostLayer is a quantity of a product that entered a warehouse at one unit
+// cost. Outgoing stock draws Remaining down oldest layer first; under average
+// costing every open layer of a product and warehouse shares the same cost.
+type CostLayer struct {
+	gorm.Model
+	ProductID       uint    `json:"product_id" gorm:"not null;index:idx_cost_layer_key"`
+	WarehouseID     uint    `json:"warehouse_id" gorm:"not null;index:idx_cost_layer_key"`
+	StockMovementID uint    `json:"stock_movement_id" gorm:"not null;index"`
+	Quantity        float64 `json:"quantity" gorm:"not null"`
+	Remaining       float64 `json:"remaining" gorm:"not null"`
+	UnitCost        float64 `json:"unit_cost" gorm:"not null"`
+}
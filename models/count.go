@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Count session statuses
+const (
+	CountOpen      = "open"
+	CountApproved  = "approved"
+	CountCancelled = "cancelled"
+)
+
+// CountSession is a cycle count or physical inventory of a set of bins and
+// products in one warehouse. Counters only see what to count; the system
+// quantity is recorded when a count is submitted and compared on approval.
+type CountSession struct {
+	gorm.Model
+	Number       string      `json:"number" gorm:"size:32;uniqueIndex"`
+	WarehouseID  uint        `json:"warehouse_id" gorm:"not null;index"`
+	Status       string      `json:"status" gorm:"size:32;not null;default:open;index"`
+	Notes        string      `json:"notes"`
+	UserID       uint        `json:"user_id" gorm:"index"`
+	ApprovedByID *uint       `json:"approved_by_id"`
+	ApprovedAt   *time.Time  `json:"approved_at"`
+	Warehouse    *Warehouse  `json:"warehouse,omitempty"`
+	Lines        []CountLine `json:"lines,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (CountSession) GetSearchableFields() []string {
+	return []string{"number", "status"}
+}
+
+// BeforeCreate is a GORM hook that assigns the next count session number
+func (s *CountSession) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.Number == "" {
+		s.Number, err = NextNumber(tx, "CS")
+	}
+	return err
+}
+
+// CountLine is one product (and lot) in one bin to be counted.
+// CountedQuantity stays nil until a counter submits it.
+type CountLine struct {
+	gorm.Model
+	CountSessionID  uint         `json:"count_session_id" gorm:"not null;index"`
+	ProductID       uint         `json:"product_id" gorm:"not null;index"`
+	BinLocationID   uint         `json:"bin_location_id" gorm:"not null;index"`
+	LotID           uint         `json:"lot_id" gorm:"not null;default:0"`
+	SystemQuantity  float64      `json:"system_quantity" gorm:"not null;default:0"`
+	CountedQuantity *float64     `json:"counted_quantity"`
+	CountedByID     *uint        `json:"counted_by_id"`
+	CountedAt       *time.Time   `json:"counted_at"`
+	Product         *Product     `json:"product,omitempty"`
+	BinLocation     *BinLocation `json:"bin_location,omitempty"`
+	Lot             *Lot         `json:"lot,omitempty" gorm:"constraint:-"`
+}
+
+// Variance returns counted minus system quantity, or 0 while uncounted
+func (l *CountLine) Variance() float64 {
+	if l.CountedQuantity == nil {
+		return 0
+	}
+	return *l.CountedQuantity - l.SystemQuantity
+}
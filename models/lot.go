@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Lot is a batch of a lot-tracked product received together
+type Lot struct {
+	gorm.Model
+	ProductID uint       `json:"product_id" gorm:"not null;uniqueIndex:idx_lot_number"`
+	Number    string     `json:"number" gorm:"size:64;not null;uniqueIndex:idx_lot_number"`
+	ExpiresAt *time.Time `json:"expires_at" gorm:"index"`
+	Product   *Product   `json:"product,omitempty"`
+}
+
+// Expired reports whether the lot is past its expiry date at t
+func (l *Lot) Expired(t time.Time) bool {
+	return l.ExpiresAt != nil && !l.ExpiresAt.After(t)
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (Lot) GetSearchableFields() []string {
+	return []string{"number"}
+}
+
+// Serial number statuses
+const (
+	SerialInStock = "in_stock"
+	SerialIssued  = "issued"
+)
+
+// SerialNumber is a single unit of a serial-tracked product. BinLocationID
+// is where the unit currently is, or nil once it has left the warehouse.
+type SerialNumber struct {
+	gorm.Model
+	ProductID     uint         `json:"product_id" gorm:"not null;uniqueIndex:idx_serial_number"`
+	Number        string       `json:"number" gorm:"size:64;not null;uniqueIndex:idx_serial_number"`
+	Status        string       `json:"status" gorm:"size:32;not null;default:in_stock;index"`
+	BinLocationID *uint        `json:"bin_location_id" gorm:"index"`
+	Product       *Product     `json:"product,omitempty"`
+	BinLocation   *BinLocation `json:"bin_location,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (SerialNumber) GetSearchableFields() []string {
+	return []string{"number", "status"}
+}
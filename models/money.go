@@ -0,0 +1,68 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is given to products and price lists saved without one
+const DefaultCurrency = "USD"
+
+// currencyExponents lists the ISO 4217 currencies whose minor unit is not a
+// hundredth of the major unit; all other currencies have two decimals
+var currencyExponents = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// CurrencyExponent returns the number of decimals of a currency's minor unit
+func CurrencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// NormalizeCurrency upper-cases a currency code, defaulting an empty code to
+// DefaultCurrency, and checks it looks like an ISO 4217 code
+func NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency, nil
+	}
+	if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("invalid currency %q, expected a three letter ISO 4217 code", currency)
+	}
+	return currency, nil
+}
+
+// AmountValue converts an amount in minor units to major units, e.g. 1999
+// USD to 19.99. Use it for reporting only; stored amounts stay integers.
+func AmountValue(amount int64, currency string) float64 {
+	return float64(amount) / math.Pow10(CurrencyExponent(currency))
+}
+
+// FormatAmount renders an amount in minor units with the currency's decimals
+func FormatAmount(amount int64, currency string) string {
+	exponent := CurrencyExponent(currency)
+	if exponent == 0 {
+		return strconv.FormatInt(amount, 10)
+	}
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	unit := int64(math.Pow10(exponent))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, exponent, amount%unit)
+}
+
+// ConvertAmount converts an amount in minor units of one currency to minor
+// units of another at rate (units of to per unit of from), rounding half
+// away from zero
+func ConvertAmount(amount int64, from, to string, rate float64) int64 {
+	shift := math.Pow10(CurrencyExponent(to) - CurrencyExponent(from))
+	return int64(math.Round(float64(amount) * rate * shift))
+}
@@ -0,0 +1,86 @@
+package models
+
+import "gorm.io/gorm"
+
+// Wave and pick list statuses
+const (
+	PickingOpen      = "open"
+	PickingCompleted = "completed"
+)
+
+// Pick list line statuses
+const (
+	PickLinePending = "pending"
+	PickLinePicked  = "picked"
+	PickLineShort   = "short"
+)
+
+// Wave groups the pick lists of several sales orders that are picked together
+type Wave struct {
+	gorm.Model
+	Number               string       `json:"number" gorm:"size:32;uniqueIndex"`
+	WarehouseID          uint         `json:"warehouse_id" gorm:"not null;index"`
+	StagingBinLocationID uint         `json:"staging_bin_location_id" gorm:"not null"`
+	Status               string       `json:"status" gorm:"size:32;not null;default:open;index"`
+	UserID               uint         `json:"user_id" gorm:"index"`
+	Warehouse            *Warehouse   `json:"warehouse,omitempty"`
+	StagingBinLocation   *BinLocation `json:"staging_bin_location,omitempty"`
+	PickLists            []PickList   `json:"pick_lists,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (Wave) GetSearchableFields() []string {
+	return []string{"number", "status"}
+}
+
+// BeforeCreate is a GORM hook that assigns the next wave number
+func (w *Wave) BeforeCreate(tx *gorm.DB) (err error) {
+	if w.Number == "" {
+		w.Number, err = NextNumber(tx, "WV")
+	}
+	return err
+}
+
+// PickList holds the lines to pick for one sales order within a wave
+type PickList struct {
+	gorm.Model
+	Number       string         `json:"number" gorm:"size:32;uniqueIndex"`
+	WaveID       uint           `json:"wave_id" gorm:"not null;index"`
+	SalesOrderID uint           `json:"sales_order_id" gorm:"not null;index"`
+	Status       string         `json:"status" gorm:"size:32;not null;default:open;index"`
+	SalesOrder   *SalesOrder    `json:"sales_order,omitempty"`
+	Lines        []PickListLine `json:"lines,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (PickList) GetSearchableFields() []string {
+	return []string{"number", "status"}
+}
+
+// BeforeCreate is a GORM hook that assigns the next pick list number
+func (p *PickList) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.Number == "" {
+		p.Number, err = NextNumber(tx, "PL")
+	}
+	return err
+}
+
+// PickListLine tells a picker to take a quantity of a product from one bin.
+// Sequence follows the bin walking path across the whole wave.
+type PickListLine struct {
+	gorm.Model
+	PickListID         uint         `json:"pick_list_id" gorm:"not null;index"`
+	SalesOrderLineID   uint         `json:"sales_order_line_id" gorm:"not null;index"`
+	StockReservationID uint         `json:"stock_reservation_id" gorm:"not null;index"`
+	ProductID          uint         `json:"product_id" gorm:"not null;index"`
+	BinLocationID      uint         `json:"bin_location_id" gorm:"not null;index"`
+	LotID              uint         `json:"lot_id" gorm:"not null;default:0"`
+	Sequence           int          `json:"sequence" gorm:"not null;default:0"`
+	Quantity           float64      `json:"quantity" gorm:"not null"`
+	PickedQuantity     float64      `json:"picked_quantity" gorm:"not null;default:0"`
+	SerialNumbers      []string     `json:"serial_numbers" gorm:"serializer:json"`
+	Status             string       `json:"status" gorm:"size:32;not null;default:pending;index"`
+	Product            *Product     `json:"product,omitempty"`
+	BinLocation        *BinLocation `json:"bin_location,omitempty"`
+	Lot                *Lot         `json:"lot,omitempty" gorm:"constraint:-"`
+}
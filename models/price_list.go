@@ -0,0 +1,167 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CustomerGroup groups customers that share price lists, e.g. wholesale
+type CustomerGroup struct {
+	gorm.Model
+	Code string `json:"code" gorm:"size:32;uniqueIndex;not null"`
+	Name string `json:"name" gorm:"not null"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (CustomerGroup) GetSearchableFields() []string {
+	return []string{"code", "name"}
+}
+
+// PriceList holds prices in one currency that override product list prices.
+// A list without a customer group applies to every customer; ValidFrom and
+// ValidTo (both inclusive, either open) limit the dates it applies on. When
+// several lists apply, the highest Priority wins, then the list for the
+// customer's group.
+type PriceList struct {
+	gorm.Model
+	Name            string          `json:"name" gorm:"not null"`
+	Currency        string          `json:"currency" gorm:"size:3;not null"`
+	CustomerGroupID *uint           `json:"customer_group_id" gorm:"index"`
+	ValidFrom       *time.Time      `json:"valid_from"`
+	ValidTo         *time.Time      `json:"valid_to"`
+	Priority        int             `json:"priority" gorm:"not null;default:0"`
+	CustomerGroup   *CustomerGroup  `json:"customer_group,omitempty"`
+	Items           []PriceListItem `json:"items,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (PriceList) GetSearchableFields() []string {
+	return []string{"name", "currency", "customer_group_id"}
+}
+
+// BeforeSave is a GORM hook that validates the currency and date range
+func (l *PriceList) BeforeSave(tx *gorm.DB) error {
+	if strings.TrimSpace(l.Name) == "" {
+		return errors.New("name is required")
+	}
+	currency, err := NormalizeCurrency(l.Currency)
+	if err != nil {
+		return err
+	}
+	tx.Statement.SetColumn("Currency", currency)
+
+	if l.ValidFrom != nil && l.ValidTo != nil && l.ValidTo.Before(*l.ValidFrom) {
+		return errors.New("valid_to cannot be before valid_from")
+	}
+	if l.CustomerGroupID != nil {
+		var group CustomerGroup
+		if err := tx.Session(&gorm.Session{NewDB: true}).First(&group, *l.CustomerGroupID).Error; err != nil {
+			return errors.New("customer group not found")
+		}
+	}
+	return nil
+}
+
+// PriceListItem is the price of a product on a price list from MinQuantity
+// base units per order line upwards. Several items for one product give
+// quantity breaks; the item with the highest MinQuantity not above the
+// ordered quantity applies.
+type PriceListItem struct {
+	gorm.Model
+	PriceListID uint       `json:"price_list_id" gorm:"not null;uniqueIndex:idx_price_list_item"`
+	ProductID   uint       `json:"product_id" gorm:"not null;uniqueIndex:idx_price_list_item;index"`
+	MinQuantity float64    `json:"min_quantity" gorm:"not null;default:0;uniqueIndex:idx_price_list_item"`
+	PriceAmount int64      `json:"price_amount" gorm:"not null"`
+	PriceList   *PriceList `json:"price_list,omitempty"`
+	Product     *Product   `json:"product,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (PriceListItem) GetSearchableFields() []string {
+	return []string{"price_list_id", "product_id"}
+}
+
+// BeforeSave is a GORM hook that validates the quantity break and price
+func (i *PriceListItem) BeforeSave(tx *gorm.DB) error {
+	if i.MinQuantity < 0 {
+		return errors.New("min_quantity cannot be negative")
+	}
+	if i.PriceAmount < 0 {
+		return errors.New("price_amount cannot be negative")
+	}
+	return nil
+}
+
+// ExchangeRate is a manually maintained rate: one unit of FromCurrency buys
+// Rate units of ToCurrency from ValidFrom until a later rate for the same
+// pair takes over
+type ExchangeRate struct {
+	gorm.Model
+	FromCurrency string    `json:"from_currency" gorm:"size:3;not null;index:idx_exchange_rate_pair"`
+	ToCurrency   string    `json:"to_currency" gorm:"size:3;not null;index:idx_exchange_rate_pair"`
+	Rate         float64   `json:"rate" gorm:"not null"`
+	ValidFrom    time.Time `json:"valid_from" gorm:"not null"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (ExchangeRate) GetSearchableFields() []string {
+	return []string{"from_currency", "to_currency"}
+}
+
+// BeforeSave is a GORM hook that validates the currency pair and rate
+func (r *ExchangeRate) BeforeSave(tx *gorm.DB) error {
+	if strings.TrimSpace(r.FromCurrency) == "" || strings.TrimSpace(r.ToCurrency) == "" {
+		return errors.New("from_currency and to_currency are required")
+	}
+	from, err := NormalizeCurrency(r.FromCurrency)
+	if err != nil {
+		return err
+	}
+	to, err := NormalizeCurrency(r.ToCurrency)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return errors.New("from_currency and to_currency must differ")
+	}
+	if r.Rate <= 0 {
+		return errors.New("rate must be positive")
+	}
+	if r.ValidFrom.IsZero() {
+		r.ValidFrom = time.Now()
+		tx.Statement.SetColumn("ValidFrom", r.ValidFrom)
+	}
+	tx.Statement.SetColumn("FromCurrency", from)
+	tx.Statement.SetColumn("ToCurrency", to)
+	return nil
+}
+
+// ErrNoExchangeRate is returned when no rate converts between two currencies
+var ErrNoExchangeRate = errors.New("no exchange rate")
+
+// FindExchangeRate returns the rate converting from one currency to another
+// on a date. A rate maintained only in the opposite direction is inverted.
+func FindExchangeRate(tx *gorm.DB, from, to string, on time.Time) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	var rate ExchangeRate
+	err := tx.Where("valid_from <= ?", on).
+		Where("(from_currency = ? AND to_currency = ?) OR (from_currency = ? AND to_currency = ?)", from, to, to, from).
+		Order("valid_from DESC, id DESC").
+		Limit(1).
+		Find(&rate).Error
+	if err != nil {
+		return 0, err
+	}
+	if rate.ID == 0 {
+		return 0, ErrNoExchangeRate
+	}
+	if rate.FromCurrency == from {
+		return rate.Rate, nil
+	}
+	return 1 / rate.Rate, nil
+}
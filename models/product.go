@@ -1,16 +1,380 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Product tracking modes
+const (
+	TrackingNone   = "none"
+	TrackingLot    = "lot"
+	TrackingSerial = "serial"
+)
 
 // Product represents a product in the system
 type Product struct {
 	gorm.Model
-	Name   string  `json:"name"`
-	Price  float64 `json:"price"`
-	Status string  `json:"status"`
+	Name string `json:"name"`
+	// PriceAmount is the list price in minor units of Currency (cents for
+	// USD), the fallback when no price list applies
+	PriceAmount int64  `json:"price_amount" gorm:"not null;default:0"`
+	Currency    string `json:"currency" gorm:"size:3;not null;default:USD"`
+	Status      string `json:"status"`
+	// Tracking is none, lot or serial and decides what stock movements must carry
+	Tracking string `json:"tracking" gorm:"size:16;not null;default:none"`
+	// BaseUnitID is the unit all stock quantities are kept in. Divisible
+	// products may hold fractional base quantities, e.g. kilograms.
+	BaseUnitID *uint          `json:"base_unit_id"`
+	Divisible  bool           `json:"divisible" gorm:"not null;default:false"`
+	BaseUnit   *UnitOfMeasure `json:"base_unit,omitempty" gorm:"foreignKey:BaseUnitID"`
+	Units      []ProductUnit  `json:"units,omitempty"`
+
+	// Components is the bill of materials; products that have one are kits
+	Components []BOMLine `json:"components,omitempty" gorm:"foreignKey:ProductID"`
+
+	// StandardCost values the product under the standard costing method and
+	// stands in for unknown costs under the other methods
+	StandardCost float64 `json:"standard_cost" gorm:"not null;default:0"`
+	// previousStandardCost is the stored standard cost while a new one is saved
+	previousStandardCost *float64
+
+	// CategoryID places the product in the category tree
+	CategoryID *uint     `json:"category_id" gorm:"index"`
+	Category   *Category `json:"category,omitempty"`
+
+	// SKU is unique; products created without one are numbered SKU-000001, ...
+	SKU      string    `json:"sku" gorm:"size:64;uniqueIndex;not null"`
+	Barcodes []Barcode `json:"barcodes,omitempty"`
+
+	// Variants of a parent product differ by attribute values (size, color, ...)
+	// and each have their own SKU, price, barcodes and stock
+	ParentID        *uint            `json:"parent_id" gorm:"index"`
+	Parent          *Product         `json:"parent,omitempty"`
+	Variants        []Product        `json:"variants,omitempty" gorm:"foreignKey:ParentID"`
+	AttributeValues []AttributeValue `json:"attribute_values,omitempty" gorm:"many2many:product_attribute_values"`
 }
 
 // GetSearchableFields returns the fields that can be searched/filtered
 func (Product) GetSearchableFields() []string {
-	return []string{"name", "status"}
+	return []string{"name", "status", "sku"}
+}
+
+// FilterScope handles "attributes.<code>" filter keys, matching products
+// that carry the given attribute value (or any of a list of values)
+func (Product) FilterScope(key string, value interface{}) (func(*gorm.DB) *gorm.DB, bool) {
+	code, ok := strings.CutPrefix(key, "attributes.")
+	if !ok {
+		return nil, false
+	}
+
+	values := []interface{}{value}
+	if list, isList := value.([]interface{}); isList {
+		values = list
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("products.id IN (?)", db.Session(&gorm.Session{NewDB: true}).
+			Table("product_attribute_values").
+			Select("product_attribute_values.product_id").
+			Joins("JOIN attribute_values ON attribute_values.id = product_attribute_values.attribute_value_id").
+			Joins("JOIN attributes ON attributes.id = attribute_values.attribute_id").
+			Where("attributes.code = ? AND attribute_values.value IN ?", code, values))
+	}, true
+}
+
+// OnStandardCostChange, when set, is called in the transaction that saves
+// a product with a new standard cost. The inventory package sets it to
+// revalue the stock on hand.
+var OnStandardCostChange func(tx *gorm.DB, product *Product, previous float64) error
+
+// BeforeCreate is a GORM hook that numbers products created without a SKU
+func (p *Product) BeforeCreate(tx *gorm.DB) error {
+	if p.SKU == "" {
+		sku, err := NextNumber(tx, "SKU")
+		if err != nil {
+			return err
+		}
+		p.SKU = sku
+	}
+	return nil
+}
+
+// BeforeSave is a GORM hook that validates the SKU, price, tracking mode, category and parent
+func (p *Product) BeforeSave(tx *gorm.DB) error {
+	p.SKU = strings.TrimSpace(p.SKU)
+	if p.SKU == "" && p.ID != 0 {
+		return errors.New("sku is required")
+	}
+	tx.Statement.SetColumn("SKU", p.SKU)
+
+	if p.PriceAmount < 0 {
+		return errors.New("price_amount cannot be negative")
+	}
+	currency, err := NormalizeCurrency(p.Currency)
+	if err != nil {
+		return err
+	}
+	tx.Statement.SetColumn("Currency", currency)
+
+	switch p.Tracking {
+	case "":
+		p.Tracking = TrackingNone
+		tx.Statement.SetColumn("Tracking", TrackingNone)
+	case TrackingNone, TrackingLot, TrackingSerial:
+	default:
+		return fmt.Errorf("invalid tracking %q, expected none, lot or serial", p.Tracking)
+	}
+	if p.ID != 0 {
+		if err := p.checkStockedChanges(tx.Session(&gorm.Session{NewDB: true})); err != nil {
+			return err
+		}
+	}
+
+	if p.CategoryID != nil {
+		var category Category
+		if err := tx.Session(&gorm.Session{NewDB: true}).First(&category, *p.CategoryID).Error; err != nil {
+			return errors.New("category not found")
+		}
+	}
+
+	if p.ParentID != nil {
+		if *p.ParentID == p.ID {
+			return errors.New("a product cannot be its own parent")
+		}
+		var parent Product
+		if err := tx.Session(&gorm.Session{NewDB: true}).First(&parent, *p.ParentID).Error; err != nil {
+			return errors.New("parent product not found")
+		}
+		if parent.ParentID != nil {
+			return errors.New("a variant cannot have variants of its own")
+		}
+	}
+	return nil
+}
+
+// AfterSave is a GORM hook that hands a changed standard cost to
+// OnStandardCostChange
+func (p *Product) AfterSave(tx *gorm.DB) error {
+	previous := p.previousStandardCost
+	p.previousStandardCost = nil
+	if previous == nil || OnStandardCostChange == nil {
+		return nil
+	}
+	return OnStandardCostChange(tx.Session(&gorm.Session{NewDB: true}), p, *previous)
+}
+
+// checkStockedChanges rejects a change of tracking mode once the product has
+// stock or movements: they were recorded with (or without) lots and serials
+// and would not match the new mode. Stored quantities and unit conversions
+// are kept in the base unit, so the base unit and divisibility are fixed
+// once the product has stock, movements or units.
+func (p *Product) checkStockedChanges(db *gorm.DB) error {
+	var stored Product
+	if err := db.Select("id", "tracking", "base_unit_id", "divisible", "standard_cost").First(&stored, p.ID).Error; err != nil {
+		// Not stored yet, e.g. created with an explicit ID
+		return nil
+	}
+	if stored.StandardCost != p.StandardCost {
+		p.previousStandardCost = &stored.StandardCost
+	}
+	trackingChanged := stored.Tracking != p.Tracking
+	unitChanged := !sameID(stored.BaseUnitID, p.BaseUnitID) || stored.Divisible != p.Divisible
+	if !trackingChanged && !unitChanged {
+		return nil
+	}
+
+	stocked, err := p.hasStockHistory(db)
+	if err != nil {
+		return err
+	}
+	if trackingChanged && stocked {
+		return fmt.Errorf("tracking cannot change from %s to %s while the product has stock or stock movements", stored.Tracking, p.Tracking)
+	}
+	if unitChanged {
+		var units int64
+		if err := db.Model(&ProductUnit{}).Where("product_id = ?", p.ID).Count(&units).Error; err != nil {
+			return err
+		}
+		if stocked || units > 0 {
+			return errors.New("base_unit_id and divisible cannot change while the product has stock, stock movements or unit conversions")
+		}
+	}
+	return nil
+}
+
+// sameID reports whether two optional IDs are equal
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// hasStockHistory reports whether the product has stock on hand or any stock movements
+func (p *Product) hasStockHistory(db *gorm.DB) (bool, error) {
+	var count int64
+	if err := db.Model(&StockLevel{}).Where("product_id = ? AND quantity <> 0", p.ID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count == 0 {
+		if err := db.Model(&StockMovement{}).Where("product_id = ?", p.ID).Count(&count).Error; err != nil {
+			return false, err
+		}
+	}
+	return count > 0, nil
+}
+
+// MigrateProductPrices moves a database from the old floating point products.price
+// column to minor unit amounts. Existing prices are taken to be in DefaultCurrency.
+// It must run before AutoMigrate and does nothing once the column is gone.
+func MigrateProductPrices(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&Product{}, "price") || migrator.HasColumn(&Product{}, "price_amount") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		for _, field := range []string{"PriceAmount", "Currency"} {
+			if !migrator.HasColumn(&Product{}, field) {
+				if err := migrator.AddColumn(&Product{}, field); err != nil {
+					return err
+				}
+			}
+		}
+		scale := math.Pow10(CurrencyExponent(DefaultCurrency))
+		err := tx.Exec("UPDATE products SET price_amount = ROUND(COALESCE(price, 0) * ?), currency = ?", scale, DefaultCurrency).Error
+		if err != nil {
+			return err
+		}
+		return migrator.DropColumn(&Product{}, "price")
+	})
+}
+
+// MigrateProductCodes moves a database from the indexed but optional
+// products.sku and products.barcode columns to unique SKUs and Barcode rows.
+// Products without a SKU, and all but the first product sharing one, are
+// numbered like BeforeCreate does; every barcode is copied into a Barcode
+// row before the column is dropped. It must run before AutoMigrate and does
+// nothing once the barcode column is gone.
+func MigrateProductCodes(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&Product{}) {
+		return nil
+	}
+	hasSKU := migrator.HasColumn(&Product{}, "sku")
+	hasBarcode := migrator.HasColumn(&Product{}, "barcode")
+	if hasSKU && !hasBarcode {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		// CreateTable, as AutoMigrate would migrate Product along with Barcode
+		for _, model := range []interface{}{&Sequence{}, &Barcode{}} {
+			if !migrator.HasTable(model) {
+				if err := migrator.CreateTable(model); err != nil {
+					return err
+				}
+			}
+		}
+
+		// The old SKU index was not unique; AutoMigrate recreates it
+		if hasSKU {
+			if migrator.HasIndex(&Product{}, "idx_products_sku") {
+				if err := migrator.DropIndex(&Product{}, "idx_products_sku"); err != nil {
+					return err
+				}
+			}
+		} else if err := tx.Exec("ALTER TABLE products ADD COLUMN sku VARCHAR(64)").Error; err != nil {
+			return err
+		}
+
+		var products []struct {
+			ID  uint
+			SKU *string
+		}
+		if err := tx.Table("products").Select("id", "sku").Order("id").Scan(&products).Error; err != nil {
+			return err
+		}
+		taken := map[string]bool{}
+		for _, product := range products {
+			if product.SKU != nil {
+				taken[strings.TrimSpace(*product.SKU)] = true
+			}
+		}
+		seen := map[string]bool{}
+		for _, product := range products {
+			sku := ""
+			if product.SKU != nil {
+				sku = strings.TrimSpace(*product.SKU)
+			}
+			if sku != "" && !seen[sku] {
+				seen[sku] = true
+				if sku != *product.SKU {
+					if err := tx.Table("products").Where("id = ?", product.ID).Update("sku", sku).Error; err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			for sku == "" || taken[sku] {
+				next, err := NextNumber(tx, "SKU")
+				if err != nil {
+					return err
+				}
+				sku = next
+			}
+			taken[sku] = true
+			seen[sku] = true
+			if err := tx.Table("products").Where("id = ?", product.ID).Update("sku", sku).Error; err != nil {
+				return err
+			}
+		}
+
+		if !hasBarcode {
+			return nil
+		}
+		var barcodes []struct {
+			ID      uint
+			Barcode string
+		}
+		err := tx.Table("products").Select("id", "barcode").
+			Where("barcode IS NOT NULL AND barcode <> ''").Order("id").Scan(&barcodes).Error
+		if err != nil {
+			return err
+		}
+		for _, product := range barcodes {
+			code := strings.TrimSpace(product.Barcode)
+			if code == "" {
+				continue
+			}
+			var existing Barcode
+			if err := tx.Unscoped().Where("code = ?", code).Limit(1).Find(&existing).Error; err != nil {
+				return err
+			}
+			if existing.ID != 0 {
+				if existing.ProductID == product.ID {
+					continue
+				}
+				return fmt.Errorf("barcode %s of product %d is also used by product %d", code, product.ID, existing.ProductID)
+			}
+			// Free text codes that fail their detected symbology are kept as code128
+			barcode := Barcode{ProductID: product.ID, Code: code, Type: DetectBarcodeType(code)}
+			if ValidateBarcode(barcode.Type, code) != nil {
+				barcode.Type = BarcodeCode128
+			}
+			if err := tx.Create(&barcode).Error; err != nil {
+				return fmt.Errorf("barcode %s of product %d: %w", code, product.ID, err)
+			}
+		}
+		if migrator.HasIndex(&Product{}, "idx_products_barcode") {
+			if err := migrator.DropIndex(&Product{}, "idx_products_barcode"); err != nil {
+				return err
+			}
+		}
+		return migrator.DropColumn(&Product{}, "barcode")
+	})
 }
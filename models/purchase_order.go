@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Supplier is a vendor that purchase orders are placed with
+type Supplier struct {
+	gorm.Model
+	Code  string `json:"code" gorm:"size:32;uniqueIndex;not null"`
+	Name  string `json:"name" gorm:"not null"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+	// OverReceiptTolerance is the percentage a line may be over-received by.
+	// Receipts within the tolerance are accepted and flagged, beyond it rejected.
+	OverReceiptTolerance float64 `json:"over_receipt_tolerance" gorm:"not null;default:0"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (Supplier) GetSearchableFields() []string {
+	return []string{"code", "name", "email"}
+}
+
+// Purchase order statuses
+const (
+	PurchaseOrderDraft             = "draft"
+	PurchaseOrderSubmitted         = "submitted"
+	PurchaseOrderPartiallyReceived = "partially_received"
+	PurchaseOrderReceived          = "received"
+	PurchaseOrderClosed            = "closed"
+	PurchaseOrderCancelled         = "cancelled"
+)
+
+// purchaseOrderTransitions lists the statuses each status may move to
+var purchaseOrderTransitions = map[string][]string{
+	PurchaseOrderDraft:             {PurchaseOrderSubmitted, PurchaseOrderCancelled},
+	PurchaseOrderSubmitted:         {PurchaseOrderPartiallyReceived, PurchaseOrderReceived, PurchaseOrderCancelled},
+	PurchaseOrderPartiallyReceived: {PurchaseOrderReceived, PurchaseOrderClosed},
+	PurchaseOrderReceived:          {PurchaseOrderClosed},
+}
+
+// PurchaseOrder is an order placed with a supplier for delivery into a warehouse
+type PurchaseOrder struct {
+	gorm.Model
+	Number      string              `json:"number" gorm:"size:32;uniqueIndex"`
+	SupplierID  uint                `json:"supplier_id" gorm:"not null;index"`
+	WarehouseID uint                `json:"warehouse_id" gorm:"not null;index"`
+	Status      string              `json:"status" gorm:"size:32;not null;default:draft;index"`
+	ExpectedAt  *time.Time          `json:"expected_at"`
+	Notes       string              `json:"notes"`
+	Supplier    *Supplier           `json:"supplier,omitempty"`
+	Warehouse   *Warehouse          `json:"warehouse,omitempty"`
+	Lines       []PurchaseOrderLine `json:"lines,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (PurchaseOrder) GetSearchableFields() []string {
+	return []string{"number", "status", "notes"}
+}
+
+// BeforeCreate is a GORM hook that assigns the next PO number
+func (po *PurchaseOrder) BeforeCreate(tx *gorm.DB) (err error) {
+	if po.Number == "" {
+		po.Number, err = NextNumber(tx, "PO")
+	}
+	return err
+}
+
+// CanTransitionTo reports whether the order may move to the given status
+func (po *PurchaseOrder) CanTransitionTo(status string) bool {
+	for _, allowed := range purchaseOrderTransitions[po.Status] {
+		if allowed == status {
+			return true
+		}
+	}
+	return false
+}
+
+// PurchaseOrderLine is a single product ordered on a purchase order
+type PurchaseOrderLine struct {
+	gorm.Model
+	PurchaseOrderID  uint    `json:"purchase_order_id" gorm:"not null;index"`
+	ProductID        uint    `json:"product_id" gorm:"not null;index"`
+	Quantity         float64 `json:"quantity" gorm:"not null"`
+	ReceivedQuantity float64 `json:"received_quantity" gorm:"not null;default:0"`
+	OverReceived     bool    `json:"over_received" gorm:"not null;default:false"`
+	// UnitCost is the price per unit the line was ordered in
+	UnitCost float64 `json:"unit_cost" gorm:"not null;default:0"`
+	// UnitOfMeasureID and UnitQuantity record the unit the line was ordered in;
+	// Quantity and ReceivedQuantity are always in the product's base unit
+	UnitOfMeasureID *uint          `json:"unit_of_measure_id"`
+	UnitQuantity    float64        `json:"unit_quantity" gorm:"not null;default:0"`
+	Product         *Product       `json:"product,omitempty"`
+	UnitOfMeasure   *UnitOfMeasure `json:"unit_of_measure,omitempty"`
+}
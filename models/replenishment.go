@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"math"
+
+	"gorm.io/gorm"
+)
+
+// Reorder methods
+const (
+	// ReorderMinMax orders up to Max when the stock position drops to Min or below
+	ReorderMinMax = "min_max"
+	// ReorderPoint orders ReorderQuantity (in multiples) when the position drops to ReorderPoint or below
+	ReorderPoint = "reorder_point"
+)
+
+// ReorderRule holds the replenishment settings of a product in a warehouse
+type ReorderRule struct {
+	gorm.Model
+	ProductID       uint       `json:"product_id" gorm:"not null;uniqueIndex:idx_reorder_rule"`
+	WarehouseID     uint       `json:"warehouse_id" gorm:"not null;uniqueIndex:idx_reorder_rule"`
+	Method          string     `json:"method" gorm:"size:32;not null;default:min_max"`
+	MinQuantity     float64    `json:"min_quantity" gorm:"not null;default:0"`
+	MaxQuantity     float64    `json:"max_quantity" gorm:"not null;default:0"`
+	ReorderPoint    float64    `json:"reorder_point" gorm:"not null;default:0"`
+	ReorderQuantity float64    `json:"reorder_quantity" gorm:"not null;default:0"`
+	SupplierID      *uint      `json:"supplier_id" gorm:"index"`
+	Product         *Product   `json:"product,omitempty"`
+	Warehouse       *Warehouse `json:"warehouse,omitempty"`
+	Supplier        *Supplier  `json:"supplier,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (ReorderRule) GetSearchableFields() []string {
+	return []string{"method"}
+}
+
+// BeforeSave is a GORM hook that validates the settings of the chosen method
+func (r *ReorderRule) BeforeSave(tx *gorm.DB) error {
+	switch r.Method {
+	case "", ReorderMinMax:
+		tx.Statement.SetColumn("Method", ReorderMinMax)
+		if r.MinQuantity < 0 {
+			return errors.New("min_quantity cannot be negative")
+		}
+		if r.MaxQuantity <= r.MinQuantity {
+			return errors.New("max_quantity must be greater than min_quantity")
+		}
+	case ReorderPoint:
+		if r.ReorderPoint < 0 {
+			return errors.New("reorder_point cannot be negative")
+		}
+		if r.ReorderQuantity <= 0 {
+			return errors.New("reorder_quantity must be greater than zero")
+		}
+	default:
+		return errors.New("method must be min_max or reorder_point")
+	}
+	return nil
+}
+
+// SuggestedQuantity returns how much to order given the stock position
+// (on hand - reserved + on order), or 0 when no order is needed
+func (r *ReorderRule) SuggestedQuantity(position float64) float64 {
+	switch r.Method {
+	case ReorderPoint:
+		if position > r.ReorderPoint {
+			return 0
+		}
+		// Order whole multiples until the position is back above the reorder point
+		return (math.Floor((r.ReorderPoint-position)/r.ReorderQuantity) + 1) * r.ReorderQuantity
+	default:
+		if position > r.MinQuantity {
+			return 0
+		}
+		return r.MaxQuantity - position
+	}
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Return authorization statuses
+const (
+	ReturnOpen      = "open"
+	ReturnReceived  = "received"
+	ReturnClosed    = "closed"
+	ReturnCancelled = "cancelled"
+)
+
+// Conditions recorded when returned goods are received
+const (
+	ConditionResellable = "resellable"
+	ConditionDamaged    = "damaged"
+	ConditionScrap      = "scrap"
+)
+
+// Dispositions deciding what happens to received returns
+const (
+	// DispositionRestock moves the goods back into a storage bin
+	DispositionRestock = "restock"
+	// DispositionQuarantine moves the goods into a quarantine bin
+	DispositionQuarantine = "quarantine"
+	// DispositionScrap writes the goods off
+	DispositionScrap = "scrap"
+)
+
+// DefaultDisposition returns the disposition that fits a condition
+func DefaultDisposition(condition string) string {
+	switch condition {
+	case ConditionResellable:
+		return DispositionRestock
+	case ConditionDamaged:
+		return DispositionQuarantine
+	default:
+		return DispositionScrap
+	}
+}
+
+// ReturnAuthorization (RMA) allows a customer to send back goods shipped on
+// a sales order. Each line authorizes a quantity of one sales order line;
+// authorized quantities never exceed what was shipped.
+type ReturnAuthorization struct {
+	gorm.Model
+	Number       string       `json:"number" gorm:"size:32;uniqueIndex"`
+	SalesOrderID uint         `json:"sales_order_id" gorm:"not null;index"`
+	CustomerID   uint         `json:"customer_id" gorm:"not null;index"`
+	WarehouseID  uint         `json:"warehouse_id" gorm:"not null;index"`
+	Status       string       `json:"status" gorm:"size:32;not null;default:open;index"`
+	Reason       string       `json:"reason"`
+	Notes        string       `json:"notes"`
+	UserID       uint         `json:"user_id" gorm:"index"`
+	SalesOrder   *SalesOrder  `json:"sales_order,omitempty"`
+	Customer     *Customer    `json:"customer,omitempty"`
+	Lines        []ReturnLine `json:"lines,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (ReturnAuthorization) GetSearchableFields() []string {
+	return []string{"number", "status", "reason", "notes"}
+}
+
+// BeforeCreate is a GORM hook that assigns the next RMA number
+func (r *ReturnAuthorization) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.Number == "" {
+		r.Number, err = NextNumber(tx, "RMA")
+	}
+	return err
+}
+
+// ReturnLine is the quantity of a sales order line a customer may return
+type ReturnLine struct {
+	gorm.Model
+	ReturnAuthorizationID uint            `json:"return_authorization_id" gorm:"not null;index"`
+	SalesOrderLineID      uint            `json:"sales_order_line_id" gorm:"not null;index"`
+	ProductID             uint            `json:"product_id" gorm:"not null;index"`
+	Quantity              float64         `json:"quantity" gorm:"not null"`
+	ReceivedQuantity      float64         `json:"received_quantity" gorm:"not null;default:0"`
+	Product               *Product        `json:"product,omitempty"`
+	Receipts              []ReturnReceipt `json:"receipts,omitempty"`
+}
+
+// ReturnReceipt records returned goods of one condition received into a
+// returns bin. The goods stay there until a disposition is applied.
+type ReturnReceipt struct {
+	gorm.Model
+	ReturnLineID  uint    `json:"return_line_id" gorm:"not null;index"`
+	ProductID     uint    `json:"product_id" gorm:"not null;index"`
+	Quantity      float64 `json:"quantity" gorm:"not null"`
+	Condition     string  `json:"condition" gorm:"size:32;not null;index"`
+	BinLocationID uint    `json:"bin_location_id" gorm:"not null"`
+	// StockMovementID is the receive movement, which carries the lot and serials
+	StockMovementID          uint           `json:"stock_movement_id" gorm:"not null"`
+	Disposition              string         `json:"disposition" gorm:"size:32;index"`
+	DispositionBinLocationID *uint          `json:"disposition_bin_location_id"`
+	DisposedAt               *time.Time     `json:"disposed_at"`
+	UserID                   uint           `json:"user_id" gorm:"index"`
+	StockMovement            *StockMovement `json:"stock_movement,omitempty"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import "gorm.io/gorm"
+
+// Customer is a party that sales orders are placed for
+type Customer struct {
+	gorm.Model
+	Code  string `json:"code" gorm:"size:32;uniqueIndex;not null"`
+	Name  string `json:"name" gorm:"not null"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+	// CustomerGroupID selects the group price lists that apply to the customer
+	CustomerGroupID *uint          `json:"customer_group_id" gorm:"index"`
+	CustomerGroup   *CustomerGroup `json:"customer_group,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (Customer) GetSearchableFields() []string {
+	return []string{"code", "name", "email"}
+}
+
+// Sales order statuses
+const (
+	SalesOrderDraft            = "draft"
+	SalesOrderConfirmed        = "confirmed"
+	SalesOrderPartiallyShipped = "partially_shipped"
+	SalesOrderShipped          = "shipped"
+	SalesOrderClosed           = "closed"
+	SalesOrderCancelled        = "cancelled"
+)
+
+// salesOrderTransitions lists the statuses each status may move to
+var salesOrderTransitions = map[string][]string{
+	SalesOrderDraft:            {SalesOrderConfirmed, SalesOrderCancelled},
+	SalesOrderConfirmed:        {SalesOrderPartiallyShipped, SalesOrderShipped, SalesOrderCancelled},
+	SalesOrderPartiallyShipped: {SalesOrderShipped, SalesOrderClosed},
+}
+
+// SalesOrder is a customer order fulfilled from a warehouse
+type SalesOrder struct {
+	gorm.Model
+	Number      string           `json:"number" gorm:"size:32;uniqueIndex"`
+	CustomerID  uint             `json:"customer_id" gorm:"not null;index"`
+	WarehouseID uint             `json:"warehouse_id" gorm:"not null;index"`
+	Status      string           `json:"status" gorm:"size:32;not null;default:draft;index"`
+	Notes       string           `json:"notes"`
+	Customer    *Customer        `json:"customer,omitempty"`
+	Warehouse   *Warehouse       `json:"warehouse,omitempty"`
+	Lines       []SalesOrderLine `json:"lines,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (SalesOrder) GetSearchableFields() []string {
+	return []string{"number", "status", "notes"}
+}
+
+// BeforeCreate is a GORM hook that assigns the next SO number
+func (so *SalesOrder) BeforeCreate(tx *gorm.DB) (err error) {
+	if so.Number == "" {
+		so.Number, err = NextNumber(tx, "SO")
+	}
+	return err
+}
+
+// CanTransitionTo reports whether the order may move to the given status
+func (so *SalesOrder) CanTransitionTo(status string) bool {
+	for _, allowed := range salesOrderTransitions[so.Status] {
+		if allowed == status {
+			return true
+		}
+	}
+	return false
+}
+
+// SalesOrderLine is a single product ordered on a sales order
+type SalesOrderLine struct {
+	gorm.Model
+	SalesOrderID     uint    `json:"sales_order_id" gorm:"not null;index"`
+	ProductID        uint    `json:"product_id" gorm:"not null;index"`
+	Quantity         float64 `json:"quantity" gorm:"not null"`
+	ReservedQuantity float64 `json:"reserved_quantity" gorm:"not null;default:0"`
+	PickedQuantity   float64 `json:"picked_quantity" gorm:"not null;default:0"`
+	ShippedQuantity  float64 `json:"shipped_quantity" gorm:"not null;default:0"`
+	// BackorderedQuantity is what short picks left that no other stock could
+	// be reserved for
+	BackorderedQuantity float64 `json:"backordered_quantity" gorm:"not null;default:0"`
+	// UnitOfMeasureID and UnitQuantity record the unit the line was sold in;
+	// all other quantities are in the product's base unit
+	UnitOfMeasureID *uint          `json:"unit_of_measure_id"`
+	UnitQuantity    float64        `json:"unit_quantity" gorm:"not null;default:0"`
+	Product         *Product       `json:"product,omitempty"`
+	UnitOfMeasure   *UnitOfMeasure `json:"unit_of_measure,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Sequence stores the last number handed out for a document prefix (PO, SO, ...)
+type Sequence struct {
+	Name  string `json:"name" gorm:"primaryKey;size:32"`
+	Value uint   `json:"value" gorm:"not null;default:0"`
+}
+
+// NextNumber increments the sequence for prefix and returns a formatted
+// document number such as PO-000042. Run it inside the transaction that
+// creates the document so the number is only consumed on commit.
+func NextNumber(tx *gorm.DB, prefix string) (string, error) {
+	tx = tx.Session(&gorm.Session{NewDB: true})
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Sequence{Name: prefix}).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Model(&Sequence{}).Where("name = ?", prefix).
+		Update("value", gorm.Expr("value + 1")).Error; err != nil {
+		return "", err
+	}
+
+	var seq Sequence
+	if err := tx.First(&seq, "name = ?", prefix).Error; err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%06d", prefix, seq.Value), nil
+}
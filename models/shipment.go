@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Shipment statuses
+const (
+	ShipmentOpen = "open"
+	// ShipmentBooking is set while the carrier books the label; a booking
+	// shipment with a tracking number has a label whose stock is not issued yet
+	ShipmentBooking   = "booking"
+	ShipmentShipped   = "shipped"
+	ShipmentCancelled = "cancelled"
+)
+
+// Shipment is a set of packages sent to the customer of a sales order.
+// An order may be delivered in several (partial) shipments.
+type Shipment struct {
+	gorm.Model
+	Number         string      `json:"number" gorm:"size:32;uniqueIndex"`
+	SalesOrderID   uint        `json:"sales_order_id" gorm:"not null;index"`
+	Status         string      `json:"status" gorm:"size:32;not null;default:open;index"`
+	Carrier        string      `json:"carrier" gorm:"size:64;not null"`
+	Service        string      `json:"service"`
+	TrackingNumber string      `json:"tracking_number" gorm:"index"`
+	ShippedAt      *time.Time  `json:"shipped_at"`
+	UserID         uint        `json:"user_id" gorm:"index"`
+	SalesOrder     *SalesOrder `json:"sales_order,omitempty"`
+	Packages       []Package   `json:"packages,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (Shipment) GetSearchableFields() []string {
+	return []string{"number", "status", "carrier", "tracking_number"}
+}
+
+// BeforeCreate is a GORM hook that assigns the next shipment number
+func (s *Shipment) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.Number == "" {
+		s.Number, err = NextNumber(tx, "SH")
+	}
+	return err
+}
+
+// Package is a single parcel within a shipment
+type Package struct {
+	gorm.Model
+	ShipmentID     uint          `json:"shipment_id" gorm:"not null;index"`
+	Weight         float64       `json:"weight"`
+	Length         float64       `json:"length"`
+	Width          float64       `json:"width"`
+	Height         float64       `json:"height"`
+	TrackingNumber string        `json:"tracking_number" gorm:"index"`
+	Lines          []PackageLine `json:"lines,omitempty"`
+}
+
+// PackageLine is a quantity of a sales order line packed into a package
+type PackageLine struct {
+	gorm.Model
+	PackageID        uint     `json:"package_id" gorm:"not null;index"`
+	SalesOrderLineID uint     `json:"sales_order_line_id" gorm:"not null;index"`
+	ProductID        uint     `json:"product_id" gorm:"not null;index"`
+	Quantity         float64  `json:"quantity" gorm:"not null"`
+	Product          *Product `json:"product,omitempty"`
+}
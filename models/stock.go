@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StockLevel holds the on-hand and reserved quantity of a product (and lot)
+// in a single bin location. LotID is 0 for products that are not lot-tracked.
+type StockLevel struct {
+	gorm.Model
+	ProductID     uint         `json:"product_id" gorm:"not null;uniqueIndex:idx_stock_level_key"`
+	BinLocationID uint         `json:"bin_location_id" gorm:"not null;uniqueIndex:idx_stock_level_key"`
+	LotID         uint         `json:"lot_id" gorm:"not null;default:0;uniqueIndex:idx_stock_level_key"`
+	Quantity      float64      `json:"quantity" gorm:"not null;default:0"`
+	Reserved      float64      `json:"reserved" gorm:"not null;default:0"`
+	Product       *Product     `json:"product,omitempty"`
+	BinLocation   *BinLocation `json:"bin_location,omitempty"`
+	Lot           *Lot         `json:"lot,omitempty" gorm:"constraint:-"`
+}
+
+// Available returns the quantity that can still be promised (on hand minus reserved)
+func (s StockLevel) Available() float64 {
+	return s.Quantity - s.Reserved
+}
+
+// MigrateStockLevelKey drops a unique idx_stock_level_key that predates lot
+// tracking and so only covers product and bin. AutoMigrate keeps an index
+// whose name exists and recreates it with lot_id once it is gone, so this
+// must run before AutoMigrate.
+func MigrateStockLevelKey(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&StockLevel{}) || !migrator.HasIndex(&StockLevel{}, "idx_stock_level_key") {
+		return nil
+	}
+	indexes, err := migrator.GetIndexes(&StockLevel{})
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if index.Name() == "idx_stock_level_key" && slices.Contains(index.Columns(), "lot_id") {
+			return nil
+		}
+	}
+	return migrator.DropIndex(&StockLevel{}, "idx_stock_level_key")
+}
+
+// StockReservation ties reserved quantity on a stock level to a sales order line
+type StockReservation struct {
+	gorm.Model
+	SalesOrderLineID uint        `json:"sales_order_line_id" gorm:"not null;index"`
+	StockLevelID     uint        `json:"stock_level_id" gorm:"not null;index"`
+	ProductID        uint        `json:"product_id" gorm:"not null;index"`
+	Quantity         float64     `json:"quantity" gorm:"not null"`
+	StockLevel       *StockLevel `json:"stock_level,omitempty"`
+}
+
+// Stock movement types
+const (
+	MovementReceive  = "receive"
+	MovementIssue    = "issue"
+	MovementTransfer = "transfer"
+	MovementAdjust   = "adjust"
+	// MovementConsume and MovementProduce take stock into and out of a work order
+	MovementConsume = "consume"
+	MovementProduce = "produce"
+	// MovementRevalue changes the value of the stock in a bin without moving
+	// any: it has a cost amount but no quantity
+	MovementRevalue = "revalue"
+)
+
+// Stock movement reference types, naming the document that caused a movement
+const (
+	ReferencePurchaseOrder = "purchase_order"
+	ReferenceSalesOrder    = "sales_order"
+	ReferenceCountSession  = "count_session"
+	ReferenceWorkOrder     = "work_order"
+	ReferenceReturn        = "return_authorization"
+	ReferenceTransferOrder = "transfer_order"
+)
+
+// StockMovement is an immutable ledger entry describing a single change in stock.
+// Lot-tracked products carry a lot, serial-tracked products one serial per unit.
+type StockMovement struct {
+	gorm.Model
+	Type              string         `json:"type" gorm:"size:32;not null;index"`
+	ProductID         uint           `json:"product_id" gorm:"not null;index"`
+	FromBinLocationID *uint          `json:"from_bin_location_id" gorm:"index"`
+	ToBinLocationID   *uint          `json:"to_bin_location_id" gorm:"index"`
+	LotID             *uint          `json:"lot_id" gorm:"index"`
+	Quantity          float64        `json:"quantity" gorm:"not null"`
+	Reason            string         `json:"reason"`
+	ReferenceType     string         `json:"reference_type" gorm:"size:32;index:idx_stock_movement_reference"`
+	ReferenceID       uint           `json:"reference_id" gorm:"index:idx_stock_movement_reference"`
+	UserID            uint           `json:"user_id" gorm:"index"`
+	Product           *Product       `json:"product,omitempty"`
+	FromBinLocation   *BinLocation   `json:"from_bin_location,omitempty" gorm:"foreignKey:FromBinLocationID"`
+	ToBinLocation     *BinLocation   `json:"to_bin_location,omitempty" gorm:"foreignKey:ToBinLocationID"`
+	User              *User          `json:"user,omitempty"`
+	Lot               *Lot           `json:"lot,omitempty"`
+	Serials           []SerialNumber `json:"serials,omitempty" gorm:"many2many:stock_movement_serials"`
+
+	// UnitCost and CostAmount value the movement: the cost per base unit and
+	// the total it moved into or out of a warehouse (cost of goods for issues).
+	// Incoming movements may set UnitCost; inventory.Post fills in the rest.
+	UnitCost   float64 `json:"unit_cost" gorm:"not null;default:0"`
+	CostAmount float64 `json:"cost_amount" gorm:"not null;default:0"`
+
+	// LotNumber and SerialNumbers identify the lot and serials by number when
+	// posting; inventory.Post resolves them into LotID and Serials
+	LotNumber     string   `json:"lot_number,omitempty" gorm:"-"`
+	SerialNumbers []string `json:"serial_numbers,omitempty" gorm:"-"`
+	// ExpiresAt sets the expiry date of a lot when it is first received
+	ExpiresAt *time.Time `json:"expires_at,omitempty" gorm:"-"`
+	// AllowExpired lets an issue take stock from an expired lot
+	AllowExpired bool `json:"-" gorm:"-"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (StockMovement) GetSearchableFields() []string {
+	return []string{"type", "reason"}
+}
+
+// BeforeUpdate is a GORM hook that keeps the ledger append-only
+func (m *StockMovement) BeforeUpdate(tx *gorm.DB) error {
+	return errors.New("stock movements are immutable")
+}
+
+// BeforeDelete is a GORM hook that keeps the ledger append-only
+func (m *StockMovement) BeforeDelete(tx *gorm.DB) error {
+	return errors.New("stock movements are immutable")
+}
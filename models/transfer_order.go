@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Transfer order statuses
+const (
+	TransferOrderDraft             = "draft"
+	TransferOrderInTransit         = "in_transit"
+	TransferOrderPartiallyReceived = "partially_received"
+	TransferOrderReceived          = "received"
+	TransferOrderCancelled         = "cancelled"
+)
+
+// TransferOrder moves stock between two warehouses. Shipping moves the goods
+// into the in-transit bin of the destination warehouse, receiving moves them
+// from there into a storage bin.
+type TransferOrder struct {
+	gorm.Model
+	Number          string              `json:"number" gorm:"size:32;uniqueIndex"`
+	FromWarehouseID uint                `json:"from_warehouse_id" gorm:"not null;index"`
+	ToWarehouseID   uint                `json:"to_warehouse_id" gorm:"not null;index"`
+	Status          string              `json:"status" gorm:"size:32;not null;default:draft;index"`
+	Notes           string              `json:"notes"`
+	UserID          uint                `json:"user_id" gorm:"index"`
+	ShippedAt       *time.Time          `json:"shipped_at"`
+	ReceivedAt      *time.Time          `json:"received_at"`
+	FromWarehouse   *Warehouse          `json:"from_warehouse,omitempty" gorm:"foreignKey:FromWarehouseID"`
+	ToWarehouse     *Warehouse          `json:"to_warehouse,omitempty" gorm:"foreignKey:ToWarehouseID"`
+	Lines           []TransferOrderLine `json:"lines,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (TransferOrder) GetSearchableFields() []string {
+	return []string{"number", "status", "notes"}
+}
+
+// BeforeCreate is a GORM hook that assigns the next transfer order number
+func (t *TransferOrder) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.Number == "" {
+		t.Number, err = NextNumber(tx, "TO")
+	}
+	return err
+}
+
+// BeforeSave is a GORM hook that rejects transfers within a single warehouse
+func (t *TransferOrder) BeforeSave(tx *gorm.DB) error {
+	if t.FromWarehouseID == t.ToWarehouseID {
+		return errors.New("source and destination warehouse must differ")
+	}
+	return nil
+}
+
+// TransferOrderLine is a quantity of one product moved by a transfer order.
+// DiscrepancyQuantity is what was shipped but reported missing on receipt.
+type TransferOrderLine struct {
+	gorm.Model
+	TransferOrderID     uint     `json:"transfer_order_id" gorm:"not null;index"`
+	ProductID           uint     `json:"product_id" gorm:"not null;index"`
+	Quantity            float64  `json:"quantity" gorm:"not null"`
+	ShippedQuantity     float64  `json:"shipped_quantity" gorm:"not null;default:0"`
+	ReceivedQuantity    float64  `json:"received_quantity" gorm:"not null;default:0"`
+	DiscrepancyQuantity float64  `json:"discrepancy_quantity" gorm:"not null;default:0"`
+	DiscrepancyReason   string   `json:"discrepancy_reason"`
+	Product             *Product `json:"product,omitempty"`
+}
+
+// InTransit returns the shipped quantity that is neither received nor missing
+func (l TransferOrderLine) InTransit() float64 {
+	return l.ShippedQuantity - l.ReceivedQuantity - l.DiscrepancyQuantity
+}
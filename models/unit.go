@@ -0,0 +1,126 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidUnit is returned when a quantity cannot be converted to the base unit
+var ErrInvalidUnit = errors.New("invalid unit of measure")
+
+// UnitOfMeasure is a unit products are counted in, e.g. each, case or pallet
+type UnitOfMeasure struct {
+	gorm.Model
+	Code string `json:"code" gorm:"size:16;uniqueIndex;not null"`
+	Name string `json:"name"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (UnitOfMeasure) GetSearchableFields() []string {
+	return []string{"code", "name"}
+}
+
+// ProductUnit defines a pack size of a product as a number of another unit,
+// e.g. 1 case = 12 each or 1 pallet = 40 cases. A nil PerUnitID means the
+// product's base unit. Chains always end at the base unit.
+type ProductUnit struct {
+	gorm.Model
+	ProductID       uint           `json:"product_id" gorm:"not null;uniqueIndex:idx_product_unit"`
+	UnitOfMeasureID uint           `json:"unit_of_measure_id" gorm:"not null;uniqueIndex:idx_product_unit"`
+	Quantity        float64        `json:"quantity" gorm:"not null"`
+	PerUnitID       *uint          `json:"per_unit_id"`
+	Product         *Product       `json:"product,omitempty"`
+	UnitOfMeasure   *UnitOfMeasure `json:"unit_of_measure,omitempty"`
+	PerUnit         *UnitOfMeasure `json:"per_unit,omitempty" gorm:"foreignKey:PerUnitID"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (ProductUnit) GetSearchableFields() []string {
+	return []string{}
+}
+
+// BeforeSave is a GORM hook that checks the conversion resolves to the base
+// unit and, for non-divisible products, to a whole number of base units
+func (pu *ProductUnit) BeforeSave(tx *gorm.DB) error {
+	if pu.Quantity <= 0 {
+		return fmt.Errorf("%w: quantity must be greater than zero", ErrInvalidUnit)
+	}
+
+	db := tx.Session(&gorm.Session{NewDB: true})
+	var product Product
+	if err := db.First(&product, pu.ProductID).Error; err != nil {
+		return errors.New("product not found")
+	}
+	if product.BaseUnitID == nil {
+		return fmt.Errorf("%w: product %d has no base unit", ErrInvalidUnit, product.ID)
+	}
+	if pu.UnitOfMeasureID == *product.BaseUnitID {
+		return fmt.Errorf("%w: the base unit cannot be converted", ErrInvalidUnit)
+	}
+
+	factor, err := resolveFactor(db, &product, pu.UnitOfMeasureID, pu)
+	if err != nil {
+		return err
+	}
+	if !product.Divisible && factor != math.Trunc(factor) {
+		return fmt.Errorf("%w: product %d is not divisible, one unit would be %g base units", ErrInvalidUnit, product.ID, factor)
+	}
+	return nil
+}
+
+// BaseFactor returns how many base units one unitID of the product is.
+// A zero unitID or the base unit itself converts 1:1.
+func BaseFactor(tx *gorm.DB, product *Product, unitID uint) (float64, error) {
+	return resolveFactor(tx, product, unitID, nil)
+}
+
+// resolveFactor follows the product's conversions from unitID to the base
+// unit. When override is set it is used instead of the stored conversion for
+// the same unit, so a conversion can be checked before it is saved.
+func resolveFactor(tx *gorm.DB, product *Product, unitID uint, override *ProductUnit) (float64, error) {
+	factor := 1.0
+	seen := map[uint]bool{}
+	for unitID != 0 && (product.BaseUnitID == nil || unitID != *product.BaseUnitID) {
+		if seen[unitID] {
+			return 0, fmt.Errorf("%w: conversions of product %d loop back to unit %d", ErrInvalidUnit, product.ID, unitID)
+		}
+		seen[unitID] = true
+
+		var conversion ProductUnit
+		if override != nil && override.UnitOfMeasureID == unitID {
+			conversion = *override
+		} else if err := tx.Where("product_id = ? AND unit_of_measure_id = ?", product.ID, unitID).First(&conversion).Error; err != nil {
+			return 0, fmt.Errorf("%w: product %d has no conversion for unit %d", ErrInvalidUnit, product.ID, unitID)
+		}
+
+		factor *= conversion.Quantity
+		unitID = 0
+		if conversion.PerUnitID != nil {
+			unitID = *conversion.PerUnitID
+		}
+	}
+	return factor, nil
+}
+
+// ToBaseQuantity converts qty in unitID to the product's base unit and
+// rejects fractional base quantities for non-divisible products
+func ToBaseQuantity(tx *gorm.DB, productID, unitID uint, qty float64) (float64, error) {
+	var product Product
+	if err := tx.First(&product, productID).Error; err != nil {
+		return 0, fmt.Errorf("%w: product %d not found", ErrInvalidUnit, productID)
+	}
+	factor, err := BaseFactor(tx, &product, unitID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Round away floating point noise such as 0.1 * 3 = 0.30000000000000004
+	base := math.Round(qty*factor*1e9) / 1e9
+	if !product.Divisible && base != math.Trunc(base) {
+		return 0, fmt.Errorf("%w: product %d is not divisible, %g base units is not a whole number", ErrInvalidUnit, productID, base)
+	}
+	return base, nil
+}
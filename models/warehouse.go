@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Warehouse represents a physical site that holds stock
+type Warehouse struct {
+	gorm.Model
+	Code    string `json:"code" gorm:"size:32;uniqueIndex;not null"`
+	Name    string `json:"name" gorm:"not null"`
+	Address string `json:"address"`
+	Status  string `json:"status" gorm:"default:active"`
+	Zones   []Zone `json:"zones,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (Warehouse) GetSearchableFields() []string {
+	return []string{"code", "name", "status"}
+}
+
+// Zone is an area inside a warehouse (e.g. cold room, bulk, pick face)
+type Zone struct {
+	gorm.Model
+	WarehouseID  uint          `json:"warehouse_id" gorm:"not null;uniqueIndex:idx_zone_code"`
+	Code         string        `json:"code" gorm:"size:32;not null;uniqueIndex:idx_zone_code"`
+	Name         string        `json:"name"`
+	Warehouse    *Warehouse    `json:"warehouse,omitempty"`
+	BinLocations []BinLocation `json:"bin_locations,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (Zone) GetSearchableFields() []string {
+	return []string{"code", "name"}
+}
+
+// BeforeSave is a GORM hook that keeps a zone with bins in its warehouse.
+// Bins copy their zone's warehouse and stock is looked up by it, so moving
+// the bins would move their stock between warehouses without movements.
+func (z *Zone) BeforeSave(tx *gorm.DB) error {
+	if z.ID == 0 {
+		return nil
+	}
+	db := tx.Session(&gorm.Session{NewDB: true})
+	var stored Zone
+	if err := db.Select("id", "warehouse_id").First(&stored, z.ID).Error; err != nil {
+		// Not stored yet, e.g. created with an explicit ID
+		return nil
+	}
+	if stored.WarehouseID == z.WarehouseID {
+		return nil
+	}
+	var bins int64
+	if err := db.Model(&BinLocation{}).Where("zone_id = ?", z.ID).Count(&bins).Error; err != nil {
+		return err
+	}
+	if bins > 0 {
+		return errors.New("warehouse_id cannot change while the zone has bin locations")
+	}
+	return nil
+}
+
+// Bin location types
+const (
+	BinTypeStorage = "storage"
+	BinTypeStaging = "staging"
+	// BinTypeReturns holds returned goods awaiting a disposition
+	BinTypeReturns = "returns"
+	// BinTypeQuarantine holds goods that must not be sold
+	BinTypeQuarantine = "quarantine"
+	// BinTypeTransit is the virtual bin holding goods shipped to the
+	// warehouse on transfer orders that have not been received yet
+	BinTypeTransit = "transit"
+)
+
+// BinLocation is the smallest addressable storage place inside a zone
+type BinLocation struct {
+	gorm.Model
+	WarehouseID uint   `json:"warehouse_id" gorm:"not null;uniqueIndex:idx_bin_code"`
+	ZoneID      uint   `json:"zone_id" gorm:"not null;index"`
+	Code        string `json:"code" gorm:"size:64;not null;uniqueIndex:idx_bin_code"`
+	Type        string `json:"type" gorm:"size:32;not null;default:storage;index"`
+	// PickSequence orders bins along the walking path within a zone
+	PickSequence int        `json:"pick_sequence" gorm:"not null;default:0"`
+	Warehouse    *Warehouse `json:"warehouse,omitempty"`
+	Zone         *Zone      `json:"zone,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (BinLocation) GetSearchableFields() []string {
+	return []string{"code", "type"}
+}
+
+// BeforeSave is a GORM hook that keeps WarehouseID in sync with the bin's zone
+func (b *BinLocation) BeforeSave(tx *gorm.DB) error {
+	var zone Zone
+	if err := tx.Session(&gorm.Session{NewDB: true}).First(&zone, b.ZoneID).Error; err != nil {
+		return errors.New("zone not found")
+	}
+	tx.Statement.SetColumn("WarehouseID", zone.WarehouseID)
+	return nil
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Work order types
+const (
+	// WorkOrderAssembly consumes components and produces the product
+	WorkOrderAssembly = "assembly"
+	// WorkOrderDisassembly consumes the product and produces its components
+	WorkOrderDisassembly = "disassembly"
+)
+
+// Work order statuses
+const (
+	WorkOrderDraft     = "draft"
+	WorkOrderCompleted = "completed"
+	WorkOrderCancelled = "cancelled"
+)
+
+// WorkOrder assembles or disassembles Quantity units of a kit in a bin.
+// The components are copied from the bill of materials when the order is
+// created, so later BOM changes do not affect open orders.
+type WorkOrder struct {
+	gorm.Model
+	Number        string          `json:"number" gorm:"size:32;uniqueIndex"`
+	Type          string          `json:"type" gorm:"size:32;not null;index"`
+	Status        string          `json:"status" gorm:"size:32;not null;default:draft;index"`
+	ProductID     uint            `json:"product_id" gorm:"not null;index"`
+	WarehouseID   uint            `json:"warehouse_id" gorm:"not null;index"`
+	BinLocationID uint            `json:"bin_location_id" gorm:"not null"`
+	Quantity      float64         `json:"quantity" gorm:"not null"`
+	LotNumber     string          `json:"lot_number"`
+	Notes         string          `json:"notes"`
+	UserID        uint            `json:"user_id" gorm:"index"`
+	CompletedAt   *time.Time      `json:"completed_at"`
+	Product       *Product        `json:"product,omitempty"`
+	BinLocation   *BinLocation    `json:"bin_location,omitempty"`
+	Lines         []WorkOrderLine `json:"lines,omitempty"`
+}
+
+// GetSearchableFields returns the fields that can be searched/filtered
+func (WorkOrder) GetSearchableFields() []string {
+	return []string{"number", "type", "status", "notes"}
+}
+
+// BeforeCreate is a GORM hook that assigns the next work order number
+func (w *WorkOrder) BeforeCreate(tx *gorm.DB) (err error) {
+	if w.Number == "" {
+		w.Number, err = NextNumber(tx, "WO")
+	}
+	return err
+}
+
+// WorkOrderLine is the quantity of one component a work order consumes
+// (assembly) or produces (disassembly)
+type WorkOrderLine struct {
+	gorm.Model
+	WorkOrderID uint     `json:"work_order_id" gorm:"not null;index"`
+	ProductID   uint     `json:"product_id" gorm:"not null;index"`
+	Quantity    float64  `json:"quantity" gorm:"not null"`
+	Product     *Product `json:"product,omitempty"`
+}
@@ -2,7 +2,6 @@
 package restful
 
 import (
-	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -56,11 +55,33 @@ func (c *CrudController[T]) Index(ctx *gin.Context) {
 		}
 	}
 
+	// Sparse fieldsets (?fields= and fields[relation]=)
+	query, selection, err := ApplyFields(query, ctx.Query("fields"), ctx.QueryMap("fields"), relations, model)
+	if err != nil {
+		RespondQueryError(ctx, err)
+		return
+	}
+
 	// 4. Apply Filters (The Trait Logic)
-	query = ApplyFilters(query, filterJSON, search, model)
+	query, err = ApplyFilters(query, filterJSON, search, model)
+	if err != nil {
+		RespondQueryError(ctx, err)
+		return
+	}
+
+	// Keyset pagination mode (?cursor=, empty for the first page)
+	// created_at may be null, so cursors sort on the primary key by default
+	if cursor, ok := ctx.GetQuery("cursor"); ok {
+		c.cursorIndex(ctx, query, selection, cursor, ctx.DefaultQuery("sort", "id"), order, limit)
+		return
+	}
 
 	// 5. Sorting
-	query = query.Order(fmt.Sprintf("%s %s", sort, order))
+	query, err = ApplySort(query, sort, order, model)
+	if err != nil {
+		RespondQueryError(ctx, err)
+		return
+	}
 
 	// 6. Pagination count
 	query.Count(&total)
@@ -75,6 +96,20 @@ func (c *CrudController[T]) Index(ctx *gin.Context) {
 	}
 
 	// 8. Return Response
+	if selection.Sparse() {
+		data, err := shapeList(selection, items)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, PaginationResponse[interface{}]{
+			Data:  data,
+			Total: total,
+			Page:  page,
+			Limit: limit,
+		})
+		return
+	}
 	ctx.JSON(http.StatusOK, PaginationResponse[T]{
 		Data:  items,
 		Total: total,
@@ -90,17 +125,33 @@ func (c *CrudController[T]) Show(ctx *gin.Context) {
 
 	// Handle Relations
 	query := c.DB
-	if relations := ctx.Query("relations"); relations != "" {
+	relations := ctx.Query("relations")
+	if relations != "" {
 		for _, rel := range strings.Split(relations, ",") {
 			query = query.Preload(strings.TrimSpace(rel))
 		}
 	}
 
+	query, selection, err := ApplyFields(query, ctx.Query("fields"), ctx.QueryMap("fields"), relations, item)
+	if err != nil {
+		RespondQueryError(ctx, err)
+		return
+	}
+
 	if err := query.First(&item, "id = ?", id).Error; err != nil {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
 		return
 	}
 
+	if selection.Sparse() {
+		shaped, err := selection.Shape(&item)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, shaped)
+		return
+	}
 	ctx.JSON(http.StatusOK, item)
 }
 
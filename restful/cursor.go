@@ -0,0 +1,281 @@
+// restful/cursor.go
+package restful
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// cursorKey signs cursors. It is random until SetCursorSecret is called, so
+// cursors then only survive as long as the process.
+var cursorKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// SetCursorSecret derives the key that signs pagination cursors from a secret
+func SetCursorSecret(secret string) {
+	key := sha256.Sum256([]byte("restful cursor:" + secret))
+	cursorKey = key[:]
+}
+
+// CursorResponse is the response of the keyset pagination mode. Total is
+// only counted when asked for with ?total=true.
+type CursorResponse[T any] struct {
+	Data       []T     `json:"data"`
+	Limit      int     `json:"limit"`
+	NextCursor *string `json:"next_cursor"`
+	PrevCursor *string `json:"prev_cursor"`
+	Total      *int64  `json:"total,omitempty"`
+}
+
+// cursor marks a position in a sorted listing: the sort value and primary
+// key of the row next to it. Prev cursors page backwards from that row.
+type cursor struct {
+	Table string          `json:"t"`
+	Sort  string          `json:"s"`
+	Desc  bool            `json:"d"`
+	Value json.RawMessage `json:"v"`
+	ID    json.RawMessage `json:"i"`
+	Prev  bool            `json:"p,omitempty"`
+}
+
+// encode serializes and signs a cursor
+func (c cursor) encode() string {
+	payload, _ := json.Marshal(c)
+	mac := hmac.New(sha256.New, cursorKey)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// decodeCursor verifies and parses a cursor
+func decodeCursor(value string) (cursor, error) {
+	var c cursor
+	invalid := queryError("cursor", "", CodeInvalidCursor, "invalid cursor")
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return c, invalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return c, invalid
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return c, invalid
+	}
+	mac := hmac.New(sha256.New, cursorKey)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return c, invalid
+	}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, invalid
+	}
+	return c, nil
+}
+
+// keysetValue decodes a cursor value into the Go type of a field, so it is
+// bound exactly like the stored values
+func keysetValue(field *schema.Field, raw json.RawMessage) (interface{}, error) {
+	value := reflect.New(field.FieldType)
+	if err := json.Unmarshal(raw, value.Interface()); err != nil {
+		return nil, queryError("cursor", "", CodeInvalidCursor, "invalid cursor")
+	}
+	return value.Elem().Interface(), nil
+}
+
+// keysetSortable reports whether cursors can be built on a field. Only
+// primary keys and NOT NULL columns qualify: a NULL never compares greater
+// or less than the cursor value, so its rows would drop out of every page.
+func keysetSortable(field *schema.Field) bool {
+	if !field.PrimaryKey && !field.NotNull {
+		return false
+	}
+	if field.FieldType == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+	switch field.FieldType.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// cursorIndex lists a filtered query with keyset pagination: rows after
+// (or, for prev cursors, before) the cursor position in sort order, with the
+// primary key breaking ties. Rows inserted or deleted elsewhere in the table
+// never shift a page, unlike with offsets.
+func (c *CrudController[T]) cursorIndex(ctx *gin.Context, query *gorm.DB, selection *Selection, value, sortKey, order string, limit int) {
+	var model T
+	if limit < 1 {
+		limit = 20
+	}
+
+	fields, err := newFieldSet(c.DB, model)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	pk := fields.schema.PrioritizedPrimaryField
+	if pk == nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "cursor pagination needs a primary key"})
+		return
+	}
+
+	// The first page comes from ?sort and ?order, later pages from the cursor
+	position := cursor{Table: fields.schema.Table}
+	if value != "" {
+		if position, err = decodeCursor(value); err != nil || position.Table != fields.schema.Table {
+			RespondQueryError(ctx, queryError("cursor", "", CodeInvalidCursor, "invalid cursor"))
+			return
+		}
+		sortKey = position.Sort
+	} else {
+		switch strings.ToLower(order) {
+		case "asc":
+		case "desc":
+			position.Desc = true
+		default:
+			RespondQueryError(ctx, queryError("order", "", CodeInvalidValue, "order must be asc or desc"))
+			return
+		}
+	}
+	field, err := fields.sortField(sortKey)
+	if err != nil {
+		RespondQueryError(ctx, err)
+		return
+	}
+	if !keysetSortable(field) {
+		RespondQueryError(ctx, queryError("sort", sortKey, CodeInvalidValue, "cursor pagination needs a primary key or NOT NULL column, not %q", sortKey))
+		return
+	}
+	position.Sort = field.DBName
+	if selection.columns != nil {
+		// The next cursors are built from the sort column
+		query = query.Select(selection.selected(field.DBName))
+	}
+
+	var response CursorResponse[T]
+	if total, _ := strconv.ParseBool(ctx.Query("total")); total {
+		var count int64
+		if err := query.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response.Total = &count
+	}
+
+	sortColumn := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+	idColumn := clause.Column{Table: clause.CurrentTable, Name: pk.DBName}
+
+	// Paging backwards walks the sort order in reverse and flips the page
+	desc := position.Desc != position.Prev
+	if value != "" {
+		id, err := keysetValue(pk, position.ID)
+		if err != nil {
+			RespondQueryError(ctx, err)
+			return
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		if field == pk {
+			query = query.Where(clause.Expr{SQL: "? " + op + " ?", Vars: []interface{}{idColumn, id}})
+		} else {
+			sortValue, err := keysetValue(field, position.Value)
+			if err != nil {
+				RespondQueryError(ctx, err)
+				return
+			}
+			query = query.Where(clause.Expr{
+				SQL:  "(? " + op + " ? OR (? = ? AND ? " + op + " ?))",
+				Vars: []interface{}{sortColumn, sortValue, sortColumn, sortValue, idColumn, id},
+			})
+		}
+	}
+	query = query.Order(clause.OrderByColumn{Column: sortColumn, Desc: desc})
+	if field != pk {
+		query = query.Order(clause.OrderByColumn{Column: idColumn, Desc: desc})
+	}
+
+	// One extra row tells whether there is another page
+	var items []T
+	if err := query.Limit(limit + 1).Find(&items).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	more := len(items) > limit
+	if more {
+		items = items[:limit]
+	}
+	if position.Prev {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	// edge builds the cursor that pages on from an item
+	edge := func(item *T, prev bool) *string {
+		row := reflect.ValueOf(item).Elem()
+		next := cursor{Table: position.Table, Sort: position.Sort, Desc: position.Desc, Prev: prev}
+		id, _ := pk.ValueOf(ctx, row)
+		next.ID, _ = json.Marshal(id)
+		sortValue, _ := field.ValueOf(ctx, row)
+		next.Value, _ = json.Marshal(sortValue)
+		encoded := next.encode()
+		return &encoded
+	}
+	if len(items) > 0 {
+		// Forward there is a next page when the extra row came back and a
+		// previous one whenever a cursor was followed; backwards the reverse
+		if (!position.Prev && more) || (position.Prev && value != "") {
+			response.NextCursor = edge(&items[len(items)-1], false)
+		}
+		if (position.Prev && more) || (!position.Prev && value != "") {
+			response.PrevCursor = edge(&items[0], true)
+		}
+	}
+
+	if items == nil {
+		items = []T{}
+	}
+	response.Data = items
+	response.Limit = limit
+	if selection.Sparse() {
+		data, err := shapeList(selection, items)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, CursorResponse[interface{}]{
+			Data:       data,
+			Limit:      limit,
+			NextCursor: response.NextCursor,
+			PrevCursor: response.PrevCursor,
+			Total:      response.Total,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,50 @@
+// restful/errors.go
+package restful
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Query error codes
+const (
+	CodeInvalidJSON     = "invalid_json"
+	CodeUnknownField    = "unknown_field"
+	CodeUnknownOperator = "unknown_operator"
+	CodeUnknownFunction = "unknown_function"
+	CodeInvalidValue    = "invalid_value"
+	CodeInvalidCursor   = "invalid_cursor"
+)
+
+// QueryError rejects a list query parameter (filter, q, sort, order or
+// cursor). It is returned to the client as 400 Bad Request with the
+// parameter, the offending field and a machine readable code.
+type QueryError struct {
+	Message string `json:"error"`
+	Param   string `json:"param"`
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+}
+
+func (e *QueryError) Error() string {
+	return e.Message
+}
+
+// queryError builds a QueryError with a formatted message
+func queryError(param, field, code, format string, args ...interface{}) *QueryError {
+	return &QueryError{Message: fmt.Sprintf(format, args...), Param: param, Field: field, Code: code}
+}
+
+// RespondQueryError writes err as 400 Bad Request when it is a QueryError and
+// as 500 Internal Server Error otherwise
+func RespondQueryError(ctx *gin.Context, err error) {
+	var qe *QueryError
+	if errors.As(err, &qe) {
+		ctx.JSON(http.StatusBadRequest, qe)
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
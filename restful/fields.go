@@ -0,0 +1,186 @@
+// restful/fields.go
+package restful
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// deletedAtType is the type of GORM's soft delete column
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// fieldSet resolves the filter and sort keys of a model to quoted columns
+// using the model's parsed GORM schema. Related models get their own field
+// set, aliased inside the EXISTS subquery that reaches them.
+type fieldSet struct {
+	db     *gorm.DB
+	schema *schema.Schema
+	model  interface{}
+	// table is the alias of the model's table, clause.CurrentTable for the
+	// model being listed
+	table   string
+	aliases *int
+}
+
+// newFieldSet parses the schema of model
+func newFieldSet(db *gorm.DB, model interface{}) (*fieldSet, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	return &fieldSet{db: db, schema: stmt.Schema, model: model, table: clause.CurrentTable, aliases: new(int)}, nil
+}
+
+// allowedField returns the field of a schema named by its column or Go name,
+// if it may be filtered and sorted on: it must be a column that is visible in
+// the JSON of the model and, if the model lists FilterableFields, among them
+func allowedField(sch *schema.Schema, model interface{}, name string) *schema.Field {
+	field := sch.LookUpField(name)
+	if field == nil || field.DBName == "" || field.Tag.Get("json") == "-" {
+		return nil
+	}
+	if m, ok := model.(FilterableFields); ok && !slices.Contains(m.GetFilterableFields(), field.DBName) {
+		return nil
+	}
+	return field
+}
+
+// column resolves a key of the model itself
+func (f *fieldSet) column(param, key string) (clause.Column, error) {
+	field := allowedField(f.schema, f.model, key)
+	if field == nil {
+		return clause.Column{}, queryError(param, key, CodeUnknownField, "unknown field %q", key)
+	}
+	return clause.Column{Table: f.table, Name: field.DBName}, nil
+}
+
+// sortField resolves a sort key of the model itself
+func (f *fieldSet) sortField(key string) (*schema.Field, error) {
+	field := allowedField(f.schema, f.model, key)
+	if field == nil {
+		return nil, queryError("sort", key, CodeUnknownField, "unknown field %q", key)
+	}
+	return field, nil
+}
+
+// visibleField returns the column of the model named by its column, Go or
+// JSON name, if it is visible in the model's JSON
+func (f *fieldSet) visibleField(name string) *schema.Field {
+	field := f.schema.LookUpField(name)
+	if field == nil {
+		for _, candidate := range f.schema.Fields {
+			if jsonName(candidate.Name, candidate.Tag) == name {
+				field = candidate
+				break
+			}
+		}
+	}
+	if field == nil || field.DBName == "" || field.Tag.Get("json") == "-" {
+		return nil
+	}
+	return field
+}
+
+// jsonName is the key of a struct field in JSON
+func jsonName(name string, tag reflect.StructTag) string {
+	if key, _, _ := strings.Cut(tag.Get("json"), ","); key != "" {
+		return key
+	}
+	return name
+}
+
+// relation finds a relationship visible in the model's JSON by its Go name
+// or snake_case name
+func (f *fieldSet) relation(name string) *schema.Relationship {
+	for _, rel := range f.schema.Relationships.Relations {
+		if rel.Field.Tag.Get("json") == "-" {
+			continue
+		}
+		if strings.EqualFold(rel.Name, name) || f.db.NamingStrategy.ColumnName("", rel.Name) == name {
+			return rel
+		}
+	}
+	return nil
+}
+
+// related returns the field set of a relation's model under a new alias
+func (f *fieldSet) related(rel *schema.Relationship) *fieldSet {
+	*f.aliases++
+	return &fieldSet{
+		db:      f.db,
+		schema:  rel.FieldSchema,
+		model:   reflect.New(rel.FieldSchema.ModelType).Interface(),
+		table:   fmt.Sprintf("rel_%d", *f.aliases),
+		aliases: f.aliases,
+	}
+}
+
+// exists builds an EXISTS (or NOT EXISTS) subquery over the related rows of
+// rel, correlated through the relationship's keys. Soft deleted related rows
+// never match. inner, if any, further restricts the related rows.
+func (f *fieldSet) exists(rel *schema.Relationship, sub *fieldSet, inner clause.Expression, negate bool) clause.Expression {
+	sql := "EXISTS (SELECT 1 FROM ?"
+	if negate {
+		sql = "NOT " + sql
+	}
+	vars := []interface{}{clause.Table{Name: rel.FieldSchema.Table, Alias: sub.table}}
+	var conditions []clause.Expression
+
+	if rel.JoinTable != nil {
+		// many2many: the join table links the model's and the related keys
+		joinAlias := sub.table + "_join"
+		var on []clause.Expression
+		for _, ref := range rel.References {
+			joinColumn := clause.Column{Table: joinAlias, Name: ref.ForeignKey.DBName}
+			switch {
+			case ref.PrimaryKey == nil:
+				conditions = append(conditions, equals(joinColumn, ref.PrimaryValue))
+			case ref.OwnPrimaryKey:
+				conditions = append(conditions, equals(joinColumn, clause.Column{Table: f.table, Name: ref.PrimaryKey.DBName}))
+			default:
+				on = append(on, equals(joinColumn, clause.Column{Table: sub.table, Name: ref.PrimaryKey.DBName}))
+			}
+		}
+		sql += " JOIN ? ON ?"
+		vars = append(vars, clause.Table{Name: rel.JoinTable.Table, Alias: joinAlias}, group{op: "AND", exprs: on})
+	} else {
+		for _, ref := range rel.References {
+			switch {
+			case ref.PrimaryKey == nil:
+				// polymorphic type column
+				conditions = append(conditions, equals(clause.Column{Table: sub.table, Name: ref.ForeignKey.DBName}, ref.PrimaryValue))
+			case ref.OwnPrimaryKey:
+				// has one / has many: the related rows point at the model
+				conditions = append(conditions, equals(
+					clause.Column{Table: sub.table, Name: ref.ForeignKey.DBName},
+					clause.Column{Table: f.table, Name: ref.PrimaryKey.DBName}))
+			default:
+				// belongs to: the model points at the related row
+				conditions = append(conditions, equals(
+					clause.Column{Table: sub.table, Name: ref.PrimaryKey.DBName},
+					clause.Column{Table: f.table, Name: ref.ForeignKey.DBName}))
+			}
+		}
+	}
+
+	for _, field := range rel.FieldSchema.Fields {
+		if field.DBName != "" && field.FieldType == deletedAtType {
+			conditions = append(conditions, clause.Expr{SQL: "? IS NULL", Vars: []interface{}{clause.Column{Table: sub.table, Name: field.DBName}}})
+		}
+	}
+	if inner != nil {
+		conditions = append(conditions, inner)
+	}
+	return clause.Expr{SQL: sql + " WHERE ?)", Vars: append(vars, group{op: "AND", exprs: conditions})}
+}
+
+// equals compares a column with another column or a value
+func equals(column clause.Column, value interface{}) clause.Expression {
+	return clause.Expr{SQL: "? = ?", Vars: []interface{}{column, value}}
+}
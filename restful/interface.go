@@ -1,12 +1,35 @@
 // restful/interfaces.go
 package restful
 
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
 // Filterable ensures the model tells the controller which columns are searchable.
 // Equivalent to getSearchable() in your PHP Trait.
 type Filterable interface {
 	GetSearchableFields() []string
 }
 
+// FilterableFields lets a model restrict the columns that can be filtered and
+// sorted on. Without it every column that appears in the model's JSON can be.
+type FilterableFields interface {
+	GetFilterableFields() []string
+}
+
+// FilterScoper lets a model handle filter keys that are not plain columns,
+// e.g. attribute values stored in another table. It returns false for keys
+// it does not handle, which then fall through to the default filters.
+type FilterScoper interface {
+	FilterScope(key string, value interface{}) (func(*gorm.DB) *gorm.DB, bool)
+}
+
+// FilterFunction implements a custom "function" of the filter JSON,
+// e.g. {"category_id": {"function": "descendants", "value": 5}}. column is
+// the validated column of the filter key; bind it as a parameter to quote it.
+type FilterFunction func(db *gorm.DB, column clause.Column, value interface{}) *gorm.DB
+
 // FilterRequest represents the JSON structure of your specific filters
 // e.g. ?filter={"status": "active", "created_at": {"operator": ">", "value": "..."}}
 type FilterValue struct {
@@ -4,97 +4,407 @@ package restful
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// ApplyFilters corresponds to your protected function filterAll()
-func ApplyFilters(db *gorm.DB, filterJSON string, search string, model interface{}) *gorm.DB {
+// filterFunctions holds the custom filter functions by name
+var filterFunctions = map[string]FilterFunction{}
+
+// RegisterFilterFunction makes fn available as a filter "function" under name
+func RegisterFilterFunction(name string, fn FilterFunction) {
+	filterFunctions[name] = fn
+}
+
+// filterOperators are the comparison operators a filter may use; is_null and
+// not_null take no value
+var filterOperators = map[string]bool{
+	"=": true, "!=": true, "<>": true, ">": true, ">=": true, "<": true, "<=": true,
+	"is_null": true, "not_null": true,
+}
+
+// operatorAliases maps alternative spellings to the operators above
+var operatorAliases = map[string]string{"==": "=", "is_not_null": "not_null"}
+
+// likeEscape escapes the LIKE wildcards of a value, for use with ESCAPE '!'
+var likeEscape = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// ApplyFilters corresponds to your protected function filterAll(). Filter
+// keys are checked against the model's schema and values are always bound as
+// parameters; invalid filters return a *QueryError.
+//
+// Conditions on the top level are AND-ed. "$and" and "$or" take a list of
+// filter objects and "$not" a filter object, and nest to any depth:
+//
+//	{"status": "active", "$or": [{"price_amount": {"operator": "<", "value": 1000}}, {"name": {"function": "like", "value": "X"}}]}
+func ApplyFilters(db *gorm.DB, filterJSON string, search string, model interface{}) (*gorm.DB, error) {
+	fields, err := newFieldSet(db, model)
+	if err != nil {
+		return db, err
+	}
+
 	// 1. Handle Global Search (q)
 	if search != "" {
 		if m, ok := model.(Filterable); ok {
-			fields := m.GetSearchableFields()
-			if len(fields) > 0 {
-				db = db.Where(buildSearchQuery(fields, search))
+			var conditions []clause.Expression
+			for _, name := range m.GetSearchableFields() {
+				if field := fields.schema.LookUpField(name); field != nil && field.DBName != "" {
+					conditions = append(conditions, likeExpr(clause.Column{Table: clause.CurrentTable, Name: field.DBName}, "%"+likeEscape.Replace(search)+"%", false))
+				}
+			}
+			if len(conditions) > 0 {
+				db = db.Where(group{op: "OR", exprs: conditions})
 			}
 		}
 	}
 
 	// 2. Handle JSON Filters
 	if filterJSON == "" {
-		return db
+		return db, nil
 	}
 
 	var filters map[string]interface{}
 	if err := json.Unmarshal([]byte(filterJSON), &filters); err != nil {
-		return db // Ignore invalid JSON
-	}
-
-	for key, rawVal := range filters {
-		// Handle Relations (e.g., "schedules.schedule_id")
-		if strings.Contains(key, ".") {
-			parts := strings.Split(key, ".")
-			relation := parts[0]
-			col := parts[1]
-
-			// This replicates: whereHas('relation', function($q) { ... })
-			// Note: GORM uses Joins or association queries differently.
-			// The simplest GORM equivalent for filtering on relations:
-			db = db.Joins(relation).Where(fmt.Sprintf("%s.%s = ?", relation, col), rawVal)
-			continue
-		}
-
-		// Parse the value (it could be a raw string or a JSON object)
-		valMap, isObj := rawVal.(map[string]interface{})
-
-		if !isObj {
-			// Simple equality: "status": "active"
-			db = db.Where(fmt.Sprintf("%s = ?", key), rawVal)
-			continue
-		}
-
-		// Complex logic: operator, function, between, etc.
-		operator := "="
-		if op, ok := valMap["operator"].(string); ok {
-			operator = op
-		}
-		value := valMap["value"]
-		fn := ""
-		if f, ok := valMap["function"].(string); ok {
-			fn = f
-		}
-
-		// Handle Functions (date, in, between)
-		switch fn {
-		case "date":
-			db = db.Where(fmt.Sprintf("DATE(%s) %s ?", key, operator), value)
-		case "in":
-			// value should be "1,2,3"
-			strVal := fmt.Sprintf("%v", value)
-			db = db.Where(fmt.Sprintf("%s IN ?", key), strings.Split(strVal, ","))
-		case "between":
-			strVal := fmt.Sprintf("%v", value)
-			rangeVals := strings.Split(strVal, ",")
-			if len(rangeVals) == 2 {
-				db = db.Where(fmt.Sprintf("%s BETWEEN ? AND ?", key), rangeVals[0], rangeVals[1])
+		return db, queryError("filter", "", CodeInvalidJSON, "filter must be a JSON object: %v", err)
+	}
+
+	conditions, err := fields.conditions(filters)
+	if err != nil {
+		return db, err
+	}
+	if len(conditions) > 0 {
+		db = db.Where(group{op: "AND", exprs: conditions})
+	}
+	return db, nil
+}
+
+// conditions builds the conditions of one filter object, to be AND-ed
+func (f *fieldSet) conditions(filters map[string]interface{}) ([]clause.Expression, error) {
+	// Sorted keys keep the SQL and the first reported error stable
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var conditions []clause.Expression
+	for _, key := range keys {
+		condition, err := f.condition(key, filters[key])
+		if err != nil {
+			return nil, err
+		}
+		if condition != nil {
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions, nil
+}
+
+// groupConditions builds an AND group from a filter object
+func (f *fieldSet) groupConditions(key string, value interface{}) (clause.Expression, error) {
+	filters, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, queryError("filter", key, CodeInvalidValue, "%s needs filter objects", key)
+	}
+	conditions, err := f.conditions(filters)
+	if err != nil || len(conditions) == 0 {
+		return nil, err
+	}
+	return group{op: "AND", exprs: conditions}, nil
+}
+
+// condition builds the condition of one key of a filter object
+func (f *fieldSet) condition(key string, rawVal interface{}) (clause.Expression, error) {
+	switch key {
+	case "$and", "$or":
+		list, ok := rawVal.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, queryError("filter", key, CodeInvalidValue, "%s needs a list of filter objects", key)
+		}
+		var conditions []clause.Expression
+		for _, item := range list {
+			condition, err := f.groupConditions(key, item)
+			if err != nil {
+				return nil, err
+			}
+			if condition != nil {
+				conditions = append(conditions, condition)
+			}
+		}
+		if len(conditions) == 0 {
+			return nil, nil
+		}
+		return group{op: strings.ToUpper(key[1:]), exprs: conditions}, nil
+	case "$not":
+		condition, err := f.groupConditions(key, rawVal)
+		if err != nil || condition == nil {
+			return nil, err
+		}
+		// Unlike NOT, this also matches rows where the group is unknown
+		// because of nulls, i.e. every row the group does not match
+		return clause.Expr{SQL: "CASE WHEN ? THEN 1 ELSE 0 END = 0", Vars: []interface{}{condition}}, nil
+	}
+	if strings.HasPrefix(key, "$") {
+		return nil, queryError("filter", key, CodeUnknownOperator, "unknown group %q, expected $and, $or or $not", key)
+	}
+
+	// Handle model specific filters (e.g., "attributes.color"). Scopes
+	// name the model's table, so only the listed model gets them.
+	if m, ok := f.model.(FilterScoper); ok && f.table == clause.CurrentTable {
+		if scope, handled := m.FilterScope(key, rawVal); handled {
+			return scopeExpr(f.db, scope), nil
+		}
+	}
+
+	// Handle Relations (e.g., "lines.product_id" or "orders.lines.product_id"):
+	// whereHas('lines', function($q) { ... }) as an EXISTS subquery per level
+	if name, rest, isPath := strings.Cut(key, "."); isPath {
+		rel := f.relation(name)
+		if rel == nil {
+			return nil, queryError("filter", key, CodeUnknownField, "unknown relation %q", name)
+		}
+		sub := f.related(rel)
+		inner, err := sub.condition(rest, rawVal)
+		if err != nil {
+			if qe, ok := err.(*QueryError); ok && qe.Field == rest {
+				qe.Field = key
+			}
+			return nil, err
+		}
+		return f.exists(rel, sub, inner, false), nil
+	}
+
+	// Parse the value (it could be a raw string or a JSON object)
+	valMap, isObj := rawVal.(map[string]interface{})
+
+	// Relation existence: {"lines": {"function": "has"}}, optionally with a
+	// filter object the related rows must match as "value"
+	if isObj {
+		if fn, _ := valMap["function"].(string); normalizeName(fn) == "has" || normalizeName(fn) == "doesnt_have" {
+			rel := f.relation(key)
+			if rel == nil {
+				return nil, queryError("filter", key, CodeUnknownField, "unknown relation %q", key)
+			}
+			sub := f.related(rel)
+			var inner clause.Expression
+			if value, ok := valMap["value"]; ok && value != nil {
+				var err error
+				if inner, err = sub.groupConditions(key, value); err != nil {
+					return nil, err
+				}
+			}
+			return f.exists(rel, sub, inner, normalizeName(fn) == "doesnt_have"), nil
+		}
+	}
+
+	// Columns of the model
+	column, err := f.column("filter", key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isObj {
+		// Simple equality: "status": "active"
+		return compareExpr(key, column, "=", rawVal, false)
+	}
+
+	// Complex logic: operator, function, between, etc.
+	operator := "="
+	if op, ok := valMap["operator"].(string); ok {
+		operator = normalizeName(op)
+		if alias, ok := operatorAliases[operator]; ok {
+			operator = alias
+		}
+	}
+	if !filterOperators[operator] {
+		return nil, queryError("filter", key, CodeUnknownOperator, "unknown operator %q", operator)
+	}
+	value := valMap["value"]
+	fn := ""
+	if name, ok := valMap["function"].(string); ok {
+		fn = name
+	}
+	ignoreCase, _ := valMap["ignore_case"].(bool)
+
+	// Handle registered functions (e.g. descendants)
+	if custom, ok := filterFunctions[fn]; ok {
+		return scopeExpr(f.db, func(db *gorm.DB) *gorm.DB { return custom(db, column, value) }), nil
+	}
+
+	// Handle Functions (date, in, between, ...)
+	switch normalizeName(fn) {
+	case "":
+		// Standard Operator
+		return compareExpr(key, column, operator, value, ignoreCase)
+	case "date":
+		if !isScalar(value) || value == nil {
+			return nil, queryError("filter", key, CodeInvalidValue, "date filter on %q needs a date value", key)
+		}
+		if operator == "is_null" || operator == "not_null" {
+			return nil, queryError("filter", key, CodeUnknownOperator, "operator %q cannot compare dates", operator)
+		}
+		return clause.Expr{SQL: "DATE(?) " + operator + " ?", Vars: []interface{}{column, value}}, nil
+	case "in", "not_in":
+		// value should be "1,2,3" or a list
+		values, err := listValue(key, value)
+		if err != nil {
+			return nil, err
+		}
+		sql := "? IN ?"
+		if normalizeName(fn) == "not_in" {
+			sql = "? NOT IN ?"
+		}
+		if ignoreCase {
+			for i, v := range values {
+				values[i] = clause.Expr{SQL: "LOWER(?)", Vars: []interface{}{v}}
 			}
-		case "like":
-			db = db.Where(fmt.Sprintf("%s LIKE ?", key), fmt.Sprintf("%%%v%%", value))
+			return clause.Expr{SQL: strings.Replace(sql, "?", "LOWER(?)", 1), Vars: []interface{}{column, values}}, nil
+		}
+		return clause.Expr{SQL: sql, Vars: []interface{}{column, values}}, nil
+	case "between":
+		values, err := listValue(key, value)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != 2 {
+			return nil, queryError("filter", key, CodeInvalidValue, "between filter on %q needs two values", key)
+		}
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []interface{}{column, values[0], values[1]}}, nil
+	case "like", "ilike", "starts_with", "ends_with":
+		if !isScalar(value) || value == nil {
+			return nil, queryError("filter", key, CodeInvalidValue, "%s filter on %q needs a value", fn, key)
+		}
+		pattern := likeEscape.Replace(fmt.Sprintf("%v", value))
+		switch normalizeName(fn) {
+		case "starts_with":
+			pattern += "%"
+		case "ends_with":
+			pattern = "%" + pattern
 		default:
-			// Standard Operator
-			db = db.Where(fmt.Sprintf("%s %s ?", key, operator), value)
+			pattern = "%" + pattern + "%"
+		}
+		return likeExpr(column, pattern, ignoreCase || normalizeName(fn) == "ilike"), nil
+	}
+	return nil, queryError("filter", key, CodeUnknownFunction, "unknown filter function %q", fn)
+}
+
+// ApplySort orders a query by a column of the model, validated like filter keys
+func ApplySort(db *gorm.DB, sortKey string, order string, model interface{}) (*gorm.DB, error) {
+	fields, err := newFieldSet(db, model)
+	if err != nil {
+		return db, err
+	}
+	column, err := fields.column("sort", sortKey)
+	if err != nil {
+		return db, err
+	}
+	switch strings.ToLower(order) {
+	case "asc":
+		return db.Order(clause.OrderByColumn{Column: column}), nil
+	case "desc":
+		return db.Order(clause.OrderByColumn{Column: column, Desc: true}), nil
+	default:
+		return db, queryError("order", "", CodeInvalidValue, "order must be asc or desc")
+	}
+}
+
+// group joins conditions with AND or OR inside parentheses
+type group struct {
+	op    string
+	exprs []clause.Expression
+}
+
+// Build implements clause.Expression
+func (g group) Build(builder clause.Builder) {
+	builder.WriteByte('(')
+	for i, expr := range g.exprs {
+		if i > 0 {
+			builder.WriteString(" " + g.op + " ")
 		}
+		expr.Build(builder)
 	}
+	builder.WriteByte(')')
+}
 
-	return db
+// scopeExpr runs a scope on a new session and returns the conditions it
+// added, so scopes can be nested in filter groups
+func scopeExpr(db *gorm.DB, scope func(*gorm.DB) *gorm.DB) clause.Expression {
+	tx := scope(db.Session(&gorm.Session{NewDB: true}))
+	where, _ := tx.Statement.Clauses["WHERE"].Expression.(clause.Where)
+	if len(where.Exprs) == 0 {
+		return nil
+	}
+	return group{op: "AND", exprs: where.Exprs}
+}
+
+// compareExpr compares a column with a single value. is_null and not_null
+// ignore the value; comparing with null is the same as using them.
+func compareExpr(key string, column clause.Column, operator string, value interface{}, ignoreCase bool) (clause.Expression, error) {
+	if !isScalar(value) {
+		return nil, queryError("filter", key, CodeInvalidValue, "filter on %q needs a single value", key)
+	}
+	if value == nil || operator == "is_null" || operator == "not_null" {
+		switch operator {
+		case "=", "is_null":
+			return clause.Expr{SQL: "? IS NULL", Vars: []interface{}{column}}, nil
+		case "!=", "<>", "not_null":
+			return clause.Expr{SQL: "? IS NOT NULL", Vars: []interface{}{column}}, nil
+		}
+		return nil, queryError("filter", key, CodeInvalidValue, "operator %q cannot compare %q with null", operator, key)
+	}
+	if _, isString := value.(string); isString && ignoreCase {
+		return clause.Expr{SQL: "LOWER(?) " + operator + " LOWER(?)", Vars: []interface{}{column, value}}, nil
+	}
+	return clause.Expr{SQL: "? " + operator + " ?", Vars: []interface{}{column, value}}, nil
 }
 
-func buildSearchQuery(fields []string, search string) string {
-	// Builds: field1 LIKE %s% OR field2 LIKE %s%
-	var query []string
-	for _, field := range fields {
-		query = append(query, fmt.Sprintf("%s LIKE '%%%s%%'", field, search))
+// likeExpr matches a column against a LIKE pattern whose literal parts are
+// escaped with '!'. Ignoring case lowers both sides, which behaves the same
+// on every database; without it case sensitivity follows the database.
+func likeExpr(column clause.Column, pattern string, ignoreCase bool) clause.Expression {
+	if ignoreCase {
+		return clause.Expr{SQL: "LOWER(?) LIKE LOWER(?) ESCAPE '!'", Vars: []interface{}{column, pattern}}
 	}
-	return strings.Join(query, " OR ")
+	return clause.Expr{SQL: "? LIKE ? ESCAPE '!'", Vars: []interface{}{column, pattern}}
+}
+
+// listValue accepts a comma separated string or a non-empty JSON list of single values
+func listValue(key string, value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		var values []interface{}
+		for _, part := range strings.Split(v, ",") {
+			values = append(values, part)
+		}
+		return values, nil
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, queryError("filter", key, CodeInvalidValue, "filter on %q needs at least one value", key)
+		}
+		for _, item := range v {
+			if !isScalar(item) || item == nil {
+				return nil, queryError("filter", key, CodeInvalidValue, "filter on %q needs a list of single values", key)
+			}
+		}
+		return v, nil
+	}
+	return nil, queryError("filter", key, CodeInvalidValue, "filter on %q needs a list or comma separated values", key)
+}
+
+// isScalar reports whether a decoded JSON value is a string, number, boolean or null
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case nil, string, float64, bool:
+		return true
+	}
+	return false
+}
+
+// normalizeName lower-cases an operator or function name and turns spaces
+// into underscores, so "not in" and "NOT_IN" both read not_in
+func normalizeName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
 }
@@ -0,0 +1,233 @@
+// restful/sparse.go
+package restful
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Selection is the sparse fieldset of a model or of one of its loaded
+// relations: the columns read from the database and the JSON keys kept in
+// the response. Without a fieldset everything is read and kept.
+type Selection struct {
+	fields   *fieldSet
+	rel      *schema.Relationship
+	path     string
+	columns  []string
+	keys     map[string]bool
+	children map[string]*Selection
+}
+
+// ApplyFields applies the sparse fieldsets of a request to a query: fields
+// lists the columns of the model and related, keyed by relation path (as in
+// fields[lines.product]=sku), those of its relations. Relations given a
+// fieldset are loaded as if named in relations. Fields are named by column,
+// Go or JSON name; unknown ones return a *QueryError.
+//
+// Primary and foreign keys the relations are loaded through are always
+// selected, but like any other column only returned when asked for.
+func ApplyFields(db *gorm.DB, fields string, related map[string]string, relations string, model interface{}) (*gorm.DB, *Selection, error) {
+	set, err := newFieldSet(db, model)
+	if err != nil {
+		return db, nil, err
+	}
+	root := &Selection{fields: set}
+
+	// The tree of loaded relations decides which keys must be selected
+	if relations != "" {
+		for _, path := range strings.Split(relations, ",") {
+			root.walk(strings.Split(strings.TrimSpace(path), "."))
+		}
+	}
+
+	if err := root.choose("fields", fields); err != nil {
+		return db, nil, err
+	}
+	for path, names := range related {
+		param := "fields[" + path + "]"
+		node := root.walk(strings.Split(path, "."))
+		if node == nil {
+			return db, nil, queryError(param, path, CodeUnknownField, "unknown relation %q", path)
+		}
+		if err := node.choose(param, names); err != nil {
+			return db, nil, err
+		}
+	}
+
+	if root.columns != nil {
+		db = db.Select(root.selected())
+	}
+	for _, node := range root.descendants() {
+		if node.columns != nil {
+			columns := node.selected()
+			db = db.Preload(node.path, func(tx *gorm.DB) *gorm.DB {
+				return tx.Select(columns)
+			})
+		}
+	}
+	return db, root, nil
+}
+
+// walk returns the selection of a relation path below s, adding the
+// selections on the way. It returns nil for an unknown relation.
+func (s *Selection) walk(names []string) *Selection {
+	node := s
+	for _, name := range names {
+		rel := node.fields.relation(name)
+		if rel == nil {
+			return nil
+		}
+		child, ok := node.children[rel.Name]
+		if !ok {
+			child = &Selection{fields: node.fields.related(rel), rel: rel, path: rel.Name}
+			if node.path != "" {
+				child.path = node.path + "." + rel.Name
+			}
+			if node.children == nil {
+				node.children = map[string]*Selection{}
+			}
+			node.children[rel.Name] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// choose sets the columns and JSON keys of s from a comma separated list
+func (s *Selection) choose(param, names string) error {
+	if strings.TrimSpace(names) == "" {
+		return nil
+	}
+	s.columns = []string{}
+	s.keys = map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		field := s.fields.visibleField(name)
+		if field == nil {
+			return queryError(param, name, CodeUnknownField, "unknown field %q", name)
+		}
+		s.columns = append(s.columns, field.DBName)
+		s.keys[jsonName(field.Name, field.Tag)] = true
+	}
+	return nil
+}
+
+// selected lists the chosen columns with the keys that relations are loaded
+// through
+func (s *Selection) selected(extra ...string) []string {
+	columns := append(slices.Clone(s.columns), extra...)
+	own := func(field *schema.Field) {
+		if field != nil && field.Schema == s.fields.schema && field.DBName != "" {
+			columns = append(columns, field.DBName)
+		}
+	}
+	for _, field := range s.fields.schema.PrimaryFields {
+		own(field)
+	}
+	links := make([]*schema.Relationship, 0, len(s.children)+1)
+	if s.rel != nil {
+		links = append(links, s.rel)
+	}
+	for _, child := range s.children {
+		links = append(links, child.rel)
+	}
+	for _, rel := range links {
+		for _, ref := range rel.References {
+			own(ref.PrimaryKey)
+			own(ref.ForeignKey)
+		}
+	}
+	slices.Sort(columns)
+	return slices.Compact(columns)
+}
+
+// descendants lists the relation selections below s, parents first
+func (s *Selection) descendants() []*Selection {
+	var nodes []*Selection
+	for _, child := range s.children {
+		nodes = append(nodes, child)
+		nodes = append(nodes, child.descendants()...)
+	}
+	slices.SortFunc(nodes, func(a, b *Selection) int { return strings.Compare(a.path, b.path) })
+	return nodes
+}
+
+// Sparse reports whether any fieldset was given, i.e. whether responses need
+// to be shaped
+func (s *Selection) Sparse() bool {
+	if s == nil {
+		return false
+	}
+	if s.columns != nil {
+		return true
+	}
+	for _, child := range s.children {
+		if child.Sparse() {
+			return true
+		}
+	}
+	return false
+}
+
+// Shape returns the JSON of item with only the chosen keys and the loaded
+// relations
+func (s *Selection) Shape(item interface{}) (interface{}, error) {
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return s.prune(value), nil
+}
+
+// prune drops the keys that were not chosen from a decoded JSON value
+func (s *Selection) prune(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = s.prune(v[i])
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			if child := s.childByKey(key); child != nil {
+				v[key] = child.prune(item)
+			} else if s.keys != nil && !s.keys[key] {
+				delete(v, key)
+			}
+		}
+	}
+	return value
+}
+
+// childByKey finds a loaded relation by its JSON key
+func (s *Selection) childByKey(key string) *Selection {
+	for _, child := range s.children {
+		if jsonName(child.rel.Field.Name, child.rel.Field.Tag) == key {
+			return child
+		}
+	}
+	return nil
+}
+
+// shapeList shapes every item of a list
+func shapeList[T any](s *Selection, items []T) ([]interface{}, error) {
+	data := make([]interface{}, len(items))
+	for i := range items {
+		shaped, err := s.Shape(&items[i])
+		if err != nil {
+			return nil, err
+		}
+		data[i] = shaped
+	}
+	return data, nil
+}
@@ -17,5 +17,63 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 
 		// Product routes (all protected)
 		RegisterProductRoutes(api, db)
+
+		// Barcode and scan lookup routes (all protected)
+		RegisterBarcodeRoutes(api, db)
+
+		// Bin, product and package label routes (all protected)
+		RegisterLabelRoutes(api, db)
+
+		// Product category tree routes (all protected)
+		RegisterCategoryRoutes(api, db)
+
+		// Report routes (all protected)
+		RegisterReportRoutes(api, db)
+
+		// Bill of materials and work order routes (all protected)
+		RegisterBOMRoutes(api, db)
+		RegisterWorkOrderRoutes(api, db)
+
+		// Variant attribute routes (all protected)
+		RegisterAttributeRoutes(api, db)
+
+		// Unit of measure and product unit routes (all protected)
+		RegisterUnitRoutes(api, db)
+
+		// Warehouse, zone and bin location routes (all protected)
+		RegisterWarehouseRoutes(api, db)
+
+		// Stock level routes (all protected)
+		RegisterStockRoutes(api, db)
+
+		// Supplier and purchase order routes (all protected)
+		RegisterPurchaseOrderRoutes(api, db)
+
+		// Customer and sales order routes (all protected)
+		RegisterSalesOrderRoutes(api, db)
+
+		// Customer group, price list and exchange rate routes (all protected)
+		RegisterPriceListRoutes(api, db)
+
+		// Wave and pick list routes (all protected)
+		RegisterPickingRoutes(api, db)
+
+		// Shipment and carrier routes (all protected)
+		RegisterShipmentRoutes(api, db)
+
+		// Customer return routes (all protected)
+		RegisterReturnRoutes(api, db)
+
+		// Inter-warehouse transfer order routes (all protected)
+		RegisterTransferOrderRoutes(api, db)
+
+		// Lot and serial number trace routes (all protected)
+		RegisterTraceRoutes(api, db)
+
+		// Cycle count routes (all protected, managing sessions is admin only)
+		RegisterCountRoutes(api, db)
+
+		// Reorder rule and replenishment routes (all protected)
+		RegisterReplenishmentRoutes(api, db)
 	}
 }
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterAttributeRoutes sets up the routes for variant attributes and their values
+func RegisterAttributeRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	attributeCtrl := restful.NewCrudController[models.Attribute](db)
+	valueCtrl := restful.NewCrudController[models.AttributeValue](db)
+
+	attributes := rg.Group("/attributes")
+	attributes.Use(middleware.AuthMiddleware())
+	{
+		attributes.GET("", attributeCtrl.Index)
+		attributes.GET("/:id", attributeCtrl.Show)
+		attributes.POST("", attributeCtrl.Store)
+		attributes.PUT("/:id", attributeCtrl.Update)
+		attributes.DELETE("/:id", attributeCtrl.Destroy)
+	}
+
+	values := rg.Group("/attribute-values")
+	values.Use(middleware.AuthMiddleware())
+	{
+		values.GET("", valueCtrl.Index)
+		values.GET("/:id", valueCtrl.Show)
+		values.POST("", valueCtrl.Store)
+		values.PUT("/:id", valueCtrl.Update)
+		values.DELETE("/:id", valueCtrl.Destroy)
+	}
+}
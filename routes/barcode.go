@@ -0,0 +1,129 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterBarcodeRoutes sets up the routes for product barcodes and the scan lookup
+func RegisterBarcodeRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	barcodeCtrl := restful.NewCrudController[models.Barcode](db)
+
+	barcodes := rg.Group("/barcodes")
+	barcodes.Use(middleware.AuthMiddleware())
+	{
+		barcodes.GET("", barcodeCtrl.Index)
+		barcodes.GET("/:id", barcodeCtrl.Show)
+		barcodes.POST("", barcodeCtrl.Store)
+		barcodes.PUT("/:id", barcodeCtrl.Update)
+		barcodes.DELETE("/:id", barcodeCtrl.Destroy)
+	}
+
+	scan := rg.Group("/scan")
+	scan.Use(middleware.AuthMiddleware())
+	{
+		scan.GET("/:code", scanHandler(db))
+	}
+}
+
+// Scan match types
+const (
+	scanProduct     = "product"
+	scanVariant     = "variant"
+	scanLot         = "lot"
+	scanSerial      = "serial"
+	scanBinLocation = "bin_location"
+)
+
+// scanMatch is one thing a scanned code resolved to
+type scanMatch struct {
+	Type      string      `json:"type"`
+	ID        uint        `json:"id"`
+	MatchedOn string      `json:"matched_on"`
+	Data      interface{} `json:"data"`
+}
+
+// scanHandler resolves a scanned code to the products (or variants), lots,
+// serial numbers and bin locations it identifies. Barcodes and SKUs are
+// checked first; an EAN-13 with a leading zero also matches the UPC-A it
+// encodes. All matches are returned, e.g. a bin code used in two warehouses.
+func scanHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code := strings.TrimSpace(c.Param("code"))
+		codes := []string{code}
+		if len(code) == 13 && strings.HasPrefix(code, "0") {
+			codes = append(codes, code[1:])
+		}
+
+		matches := []scanMatch{}
+		productMatch := func(product models.Product, matchedOn string) scanMatch {
+			typ := scanProduct
+			if product.ParentID != nil {
+				typ = scanVariant
+			}
+			return scanMatch{Type: typ, ID: product.ID, MatchedOn: matchedOn, Data: product}
+		}
+
+		var barcodes []models.Barcode
+		if err := db.Preload("Product.Barcodes").Preload("Product.AttributeValues.Attribute").
+			Where("code IN ?", codes).Find(&barcodes).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, barcode := range barcodes {
+			if barcode.Product != nil {
+				matches = append(matches, productMatch(*barcode.Product, "barcode"))
+			}
+		}
+
+		var products []models.Product
+		if err := db.Preload("Barcodes").Preload("AttributeValues.Attribute").
+			Where("sku = ?", code).Find(&products).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, product := range products {
+			matches = append(matches, productMatch(product, "sku"))
+		}
+
+		var lots []models.Lot
+		if err := db.Preload("Product").Where("number = ?", code).Find(&lots).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, lot := range lots {
+			matches = append(matches, scanMatch{Type: scanLot, ID: lot.ID, MatchedOn: "number", Data: lot})
+		}
+
+		var serials []models.SerialNumber
+		if err := db.Preload("Product").Preload("BinLocation").Where("number = ?", code).Find(&serials).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, serial := range serials {
+			matches = append(matches, scanMatch{Type: scanSerial, ID: serial.ID, MatchedOn: "number", Data: serial})
+		}
+
+		var bins []models.BinLocation
+		if err := db.Preload("Warehouse").Preload("Zone").Where("code = ?", code).Find(&bins).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, bin := range bins {
+			matches = append(matches, scanMatch{Type: scanBinLocation, ID: bin.ID, MatchedOn: "code", Data: bin})
+		}
+
+		if len(matches) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No product, lot, serial number or bin location matches this code"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"code": code, "data": matches})
+	}
+}
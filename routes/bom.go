@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterBOMRoutes sets up the routes for bill of materials lines
+func RegisterBOMRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	bomCtrl := restful.NewCrudController[models.BOMLine](db)
+
+	bom := rg.Group("/bom-lines")
+	bom.Use(middleware.AuthMiddleware())
+	{
+		bom.GET("", bomCtrl.Index)
+		bom.GET("/:id", bomCtrl.Show)
+		bom.POST("", bomCtrl.Store)
+		bom.PUT("/:id", bomCtrl.Update)
+		bom.DELETE("/:id", bomCtrl.Destroy)
+	}
+}
+
+// productAvailabilityHandler returns the available quantity of a product per
+// warehouse (or in ?warehouse_id= only). Kits add what can be built from
+// their components to what is already assembled.
+func productAvailabilityHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var product models.Product
+		if err := db.First(&product, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		query := db.Model(&models.Warehouse{}).Order("id")
+		if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+			query = query.Where("id = ?", warehouseID)
+		}
+		var warehouseIDs []uint
+		if err := query.Pluck("id", &warehouseIDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		data := []*inventory.KitAvailability{}
+		for _, warehouseID := range warehouseIDs {
+			availability, err := inventory.Availability(db, product.ID, warehouseID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			data = append(data, availability)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": data})
+	}
+}
@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterCategoryRoutes sets up the routes for the product category tree
+func RegisterCategoryRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	categoryCtrl := restful.NewCrudController[models.Category](db)
+
+	// {"category_id": {"function": "descendants", "value": 5}} matches a category and its subtree
+	restful.RegisterFilterFunction("descendants", models.DescendantsFilter)
+
+	categories := rg.Group("/categories")
+	categories.Use(middleware.AuthMiddleware())
+	{
+		categories.GET("", categoryCtrl.Index)
+		categories.GET("/tree", categoryTreeHandler(db))
+		categories.GET("/:id", categoryCtrl.Show)
+		categories.POST("", categoryCtrl.Store)
+		categories.PUT("/:id", categoryCtrl.Update)
+		categories.DELETE("/:id", deleteCategoryHandler(db))
+		categories.POST("/:id/move", moveCategoryHandler(db))
+	}
+}
+
+// categoryNode is a category with its children nested below it
+type categoryNode struct {
+	ID       uint            `json:"id"`
+	Name     string          `json:"name"`
+	Path     string          `json:"path"`
+	Depth    int             `json:"depth"`
+	Children []*categoryNode `json:"children"`
+}
+
+// categoryTreeHandler returns the whole category tree as nested nodes
+func categoryTreeHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var categories []models.Category
+		if err := db.Order("depth, name").Find(&categories).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Parents sort before their children, so each parent node already exists
+		nodes := map[uint]*categoryNode{}
+		roots := []*categoryNode{}
+		for _, category := range categories {
+			node := &categoryNode{ID: category.ID, Name: category.Name, Path: category.Path, Depth: category.Depth, Children: []*categoryNode{}}
+			nodes[category.ID] = node
+			if category.ParentID == nil || nodes[*category.ParentID] == nil {
+				roots = append(roots, node)
+				continue
+			}
+			parent := nodes[*category.ParentID]
+			parent.Children = append(parent.Children, node)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": roots})
+	}
+}
+
+// moveCategoryHandler reparents a category, moving its whole subtree along.
+// A null parent_id makes it a root category.
+func moveCategoryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			ParentID *uint `json:"parent_id"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var category models.Category
+		if err := db.First(&category, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+
+		category.ParentID = input.ParentID
+		if err := db.Save(&category).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+// deleteCategoryHandler deletes a category that has no subcategories and no products
+func deleteCategoryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var category models.Category
+		if err := db.First(&category, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+
+		var children, products int64
+		db.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children)
+		db.Model(&models.Product{}).Where("category_id = ?", category.ID).Count(&products)
+		if children > 0 || products > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Category still has subcategories or products"})
+			return
+		}
+
+		if err := db.Delete(&category).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Success"})
+	}
+}
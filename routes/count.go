@@ -0,0 +1,487 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterCountRoutes sets up the routes for cycle counts and physical inventory.
+// Admins create, approve and review sessions; counters only see the blind count sheet.
+func RegisterCountRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	countCtrl := restful.NewCrudController[models.CountSession](db)
+
+	counts := rg.Group("/count-sessions")
+	counts.Use(middleware.AuthMiddleware())
+	{
+		// Admin only routes
+		counts.GET("", middleware.AdminMiddleware(), countCtrl.Index)
+		counts.GET("/:id", middleware.AdminMiddleware(), countCtrl.Show)
+		counts.POST("", middleware.AdminMiddleware(), storeCountSessionHandler(db))
+		counts.POST("/:id/approve", middleware.AdminMiddleware(), approveCountSessionHandler(db))
+		counts.POST("/:id/cancel", middleware.AdminMiddleware(), cancelCountSessionHandler(db))
+		counts.GET("/:id/variance", middleware.AdminMiddleware(), countVarianceHandler(db))
+
+		// Counter routes
+		counts.GET("/:id/sheet", countSheetHandler(db))
+		counts.POST("/:id/counts", submitCountsHandler(db))
+	}
+}
+
+// storeCountSessionHandler creates a count session with one line per stock level
+// in the selected bins and products. Without bins or products the whole
+// warehouse is counted.
+func storeCountSessionHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			WarehouseID    uint   `json:"warehouse_id" binding:"required"`
+			BinLocationIDs []uint `json:"bin_location_ids"`
+			ProductIDs     []uint `json:"product_ids"`
+			Notes          string `json:"notes"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var session models.CountSession
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var count int64
+			if tx.Model(&models.Warehouse{}).Where("id = ?", input.WarehouseID).Count(&count); count == 0 {
+				return newRequestError(http.StatusBadRequest, "warehouse %d not found", input.WarehouseID)
+			}
+			binIDs := uniqueIDs(input.BinLocationIDs)
+			if len(binIDs) > 0 {
+				tx.Model(&models.BinLocation{}).Where("id IN ? AND warehouse_id = ?", binIDs, input.WarehouseID).Count(&count)
+				if int(count) != len(binIDs) {
+					return newRequestError(http.StatusBadRequest, "one or more bin locations not found in warehouse %d", input.WarehouseID)
+				}
+			}
+			var products []models.Product
+			productIDs := uniqueIDs(input.ProductIDs)
+			if len(productIDs) > 0 {
+				if err := tx.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+					return err
+				}
+				if len(products) != len(productIDs) {
+					return newRequestError(http.StatusBadRequest, "one or more products not found")
+				}
+				for _, product := range products {
+					if product.Tracking == models.TrackingSerial {
+						return newRequestError(http.StatusBadRequest, "product %d is serial tracked and cannot be counted by quantity", product.ID)
+					}
+				}
+			}
+
+			query := tx.Model(&models.StockLevel{}).
+				Joins("JOIN bin_locations ON bin_locations.id = stock_levels.bin_location_id").
+				Joins("JOIN products ON products.id = stock_levels.product_id").
+				Where("bin_locations.warehouse_id = ? AND products.tracking <> ?", input.WarehouseID, models.TrackingSerial).
+				Where("stock_levels.quantity <> 0")
+			if len(binIDs) > 0 {
+				query = query.Where("stock_levels.bin_location_id IN ?", binIDs)
+			}
+			if len(productIDs) > 0 {
+				query = query.Where("stock_levels.product_id IN ?", productIDs)
+			}
+			var levels []models.StockLevel
+			if err := query.Order("stock_levels.id").Find(&levels).Error; err != nil {
+				return err
+			}
+
+			session = models.CountSession{
+				WarehouseID: input.WarehouseID,
+				Status:      models.CountOpen,
+				Notes:       input.Notes,
+				UserID:      middleware.CurrentUserID(c),
+			}
+			seen := map[[2]uint]bool{}
+			for _, level := range levels {
+				seen[[2]uint{level.ProductID, level.BinLocationID}] = true
+				session.Lines = append(session.Lines, models.CountLine{
+					ProductID:     level.ProductID,
+					BinLocationID: level.BinLocationID,
+					LotID:         level.LotID,
+				})
+			}
+			// When both bins and products are named, also count combinations the
+			// system believes are empty so found stock can be recorded
+			for _, binID := range binIDs {
+				for _, product := range products {
+					if product.Tracking == models.TrackingNone && !seen[[2]uint{product.ID, binID}] {
+						session.Lines = append(session.Lines, models.CountLine{ProductID: product.ID, BinLocationID: binID})
+					}
+				}
+			}
+			if len(session.Lines) == 0 {
+				return newRequestError(http.StatusConflict, "nothing to count for the given bins and products")
+			}
+
+			return tx.Create(&session).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, session)
+	}
+}
+
+// blindCountMiddleware hides stock levels while a count session is open
+// from users without the stock.view_counted permission, so counters cannot
+// look up the quantities they are counting
+func blindCountMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if middleware.HasPermission(c, middleware.PermissionViewCountedStock) {
+			c.Next()
+			return
+		}
+		var session models.CountSession
+		if err := db.Select("id", "number").Where("status = ?", models.CountOpen).Limit(1).Find(&session).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if session.ID != 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("stock levels are hidden while count session %s is open", session.Number)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// countSheetLine is a line of the blind count sheet, without the system quantity
+type countSheetLine struct {
+	LineID          uint     `json:"line_id"`
+	BinLocationID   uint     `json:"bin_location_id"`
+	BinCode         string   `json:"bin_code"`
+	ZoneCode        string   `json:"zone_code"`
+	ProductID       uint     `json:"product_id"`
+	ProductName     string   `json:"product_name"`
+	LotNumber       string   `json:"lot_number,omitempty"`
+	CountedQuantity *float64 `json:"counted_quantity"`
+}
+
+// countSheetHandler returns the lines of a session in bin walking order
+// without the system quantities, so counters count blind
+func countSheetHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var session models.CountSession
+		if err := db.First(&session, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Count session not found"})
+			return
+		}
+
+		lines := []countSheetLine{}
+		err := db.Table("count_lines").
+			Select("count_lines.id AS line_id, bin_locations.id AS bin_location_id, bin_locations.code AS bin_code, "+
+				"zones.code AS zone_code, products.id AS product_id, products.name AS product_name, "+
+				"COALESCE(lots.number, '') AS lot_number, count_lines.counted_quantity").
+			Joins("JOIN bin_locations ON bin_locations.id = count_lines.bin_location_id").
+			Joins("JOIN zones ON zones.id = bin_locations.zone_id").
+			Joins("JOIN products ON products.id = count_lines.product_id").
+			Joins("LEFT JOIN lots ON lots.id = count_lines.lot_id").
+			Where("count_lines.count_session_id = ? AND count_lines.deleted_at IS NULL", session.ID).
+			Order("zones.code, bin_locations.pick_sequence, bin_locations.code, products.name, lots.number").
+			Scan(&lines).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":     session.ID,
+			"number": session.Number,
+			"status": session.Status,
+			"lines":  lines,
+		})
+	}
+}
+
+// submitCountsHandler records counted quantities for lines of an open session.
+// The system quantity is captured at the same moment, so stock that moves
+// before the count is not reported as a variance. Lines can be recounted.
+func submitCountsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Lines []struct {
+				LineID          uint     `json:"line_id" binding:"required"`
+				CountedQuantity *float64 `json:"counted_quantity" binding:"required,gte=0"`
+			} `json:"lines" binding:"required,min=1,dive"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			var session models.CountSession
+			if err := lockCountSession(tx, c.Param("id"), &session); err != nil {
+				return err
+			}
+			if session.Status != models.CountOpen {
+				return newRequestError(http.StatusConflict, "count session %s is %s", session.Number, session.Status)
+			}
+
+			now := time.Now()
+			userID := middleware.CurrentUserID(c)
+			for _, counted := range input.Lines {
+				var line models.CountLine
+				if err := tx.First(&line, "id = ? AND count_session_id = ?", counted.LineID, session.ID).Error; err != nil {
+					return newRequestError(http.StatusBadRequest, "line %d does not belong to count session %s", counted.LineID, session.Number)
+				}
+
+				var system []float64
+				if err := tx.Model(&models.StockLevel{}).
+					Where("product_id = ? AND bin_location_id = ? AND lot_id = ?", line.ProductID, line.BinLocationID, line.LotID).
+					Pluck("quantity", &system).Error; err != nil {
+					return err
+				}
+				line.SystemQuantity = 0
+				if len(system) > 0 {
+					line.SystemQuantity = system[0]
+				}
+				line.CountedQuantity = counted.CountedQuantity
+				line.CountedByID = &userID
+				line.CountedAt = &now
+				if err := tx.Model(&line).Select("system_quantity", "counted_quantity", "counted_by_id", "counted_at").Updates(&line).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Success"})
+	}
+}
+
+// approveCountSessionHandler posts every variance of a fully counted session
+// as an adjust movement and closes the session. Reservations that a lower
+// count leaves uncovered are reserved in other bins or backordered first.
+func approveCountSessionHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Reason string `json:"reason"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var session models.CountSession
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			if err := lockCountSession(tx, c.Param("id"), &session); err != nil {
+				return err
+			}
+			if session.Status != models.CountOpen {
+				return newRequestError(http.StatusConflict, "count session %s is %s", session.Number, session.Status)
+			}
+			if err := tx.Where("count_session_id = ?", session.ID).Order("id").Find(&session.Lines).Error; err != nil {
+				return err
+			}
+
+			reason := input.Reason
+			if reason == "" {
+				reason = fmt.Sprintf("Count %s", session.Number)
+			}
+			for i := range session.Lines {
+				line := &session.Lines[i]
+				if line.CountedQuantity == nil {
+					return newRequestError(http.StatusConflict, "line %d has not been counted yet", line.ID)
+				}
+				variance := line.Variance()
+				if variance == 0 {
+					continue
+				}
+
+				movement := models.StockMovement{
+					Type:          models.MovementAdjust,
+					ProductID:     line.ProductID,
+					Quantity:      math.Abs(variance),
+					Reason:        reason,
+					ReferenceType: models.ReferenceCountSession,
+					ReferenceID:   session.ID,
+					UserID:        middleware.CurrentUserID(c),
+				}
+				if variance > 0 {
+					movement.ToBinLocationID = &line.BinLocationID
+				} else {
+					// Reservations the counted stock can no longer cover move elsewhere
+					var level models.StockLevel
+					err := inventory.ForUpdate(tx).
+						Where("product_id = ? AND bin_location_id = ? AND lot_id = ?", line.ProductID, line.BinLocationID, line.LotID).
+						First(&level).Error
+					if err == nil {
+						err = inventory.Reallocate(tx, &level, session.WarehouseID, level.Quantity+variance)
+					}
+					if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+						return fmt.Errorf("line %d: %w", line.ID, err)
+					}
+					movement.FromBinLocationID = &line.BinLocationID
+				}
+				if line.LotID != 0 {
+					movement.LotID = &line.LotID
+				}
+				if err := inventory.Post(tx, &movement); err != nil {
+					return fmt.Errorf("line %d: %w", line.ID, err)
+				}
+			}
+
+			now := time.Now()
+			approvedBy := middleware.CurrentUserID(c)
+			session.Status = models.CountApproved
+			session.ApprovedByID = &approvedBy
+			session.ApprovedAt = &now
+			return tx.Model(&session).Select("status", "approved_by_id", "approved_at").Updates(&session).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+// cancelCountSessionHandler cancels an open session without touching stock
+func cancelCountSessionHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var session models.CountSession
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockCountSession(tx, c.Param("id"), &session); err != nil {
+				return err
+			}
+			if session.Status != models.CountOpen {
+				return newRequestError(http.StatusConflict, "count session %s is %s", session.Number, session.Status)
+			}
+			session.Status = models.CountCancelled
+			return tx.Model(&session).Update("status", session.Status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+// countVariance is one line of a session's variance report
+type countVariance struct {
+	LineID          uint     `json:"line_id"`
+	ProductID       uint     `json:"product_id"`
+	ProductName     string   `json:"product_name"`
+	BinLocationID   uint     `json:"bin_location_id"`
+	BinCode         string   `json:"bin_code"`
+	LotNumber       string   `json:"lot_number,omitempty"`
+	SystemQuantity  float64  `json:"system_quantity"`
+	CountedQuantity *float64 `json:"counted_quantity"`
+	Variance        float64  `json:"variance"`
+	VarianceValue   float64  `json:"variance_value"`
+}
+
+// countVarianceHandler reports system against counted quantity per line, with
+// the variance valued at the product's current unit cost in the warehouse and
+// an accuracy summary
+func countVarianceHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var session models.CountSession
+		err := db.Preload("Lines", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).
+			Preload("Lines.Product").Preload("Lines.BinLocation").Preload("Lines.Lot").
+			First(&session, "id = ?", c.Param("id")).Error
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Count session not found"})
+			return
+		}
+
+		costs := map[uint]float64{}
+		lines := make([]countVariance, 0, len(session.Lines))
+		var counted, accurate int
+		var totalValue, absoluteValue float64
+		for _, line := range session.Lines {
+			row := countVariance{
+				LineID:          line.ID,
+				ProductID:       line.ProductID,
+				BinLocationID:   line.BinLocationID,
+				SystemQuantity:  line.SystemQuantity,
+				CountedQuantity: line.CountedQuantity,
+				Variance:        line.Variance(),
+			}
+			if line.Product != nil {
+				row.ProductName = line.Product.Name
+			}
+			cost, ok := costs[line.ProductID]
+			if !ok {
+				if cost, err = inventory.UnitCost(db, line.ProductID, session.WarehouseID); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				costs[line.ProductID] = cost
+			}
+			row.VarianceValue = row.Variance * cost
+			if line.BinLocation != nil {
+				row.BinCode = line.BinLocation.Code
+			}
+			if line.Lot != nil {
+				row.LotNumber = line.Lot.Number
+			}
+			lines = append(lines, row)
+
+			if line.CountedQuantity == nil {
+				continue
+			}
+			counted++
+			if row.Variance == 0 {
+				accurate++
+			}
+			totalValue += row.VarianceValue
+			absoluteValue += math.Abs(row.VarianceValue)
+		}
+
+		accuracy := 0.0
+		if counted > 0 {
+			accuracy = float64(accurate) / float64(counted) * 100
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"id":     session.ID,
+			"number": session.Number,
+			"status": session.Status,
+			"summary": gin.H{
+				"lines":                   len(lines),
+				"counted_lines":           counted,
+				"lines_with_variance":     counted - accurate,
+				"accuracy_percent":        accuracy,
+				"net_variance_value":      totalValue,
+				"absolute_variance_value": absoluteValue,
+			},
+			"lines": lines,
+		})
+	}
+}
+
+// lockCountSession loads a count session and locks its row for the rest of the transaction
+func lockCountSession(tx *gorm.DB, id string, session *models.CountSession) error {
+	if err := inventory.ForUpdate(tx).First(session, "id = ?", id).Error; err != nil {
+		return newRequestError(http.StatusNotFound, "Count session not found")
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/gin-gonic/gin"
+)
+
+// requestError aborts a handler (usually from inside a transaction) with a specific status
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// newRequestError builds a requestError with a formatted message
+func newRequestError(status int, format string, args ...interface{}) error {
+	return &requestError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// errorStatus maps request and inventory errors to HTTP status codes
+func errorStatus(err error) int {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		return reqErr.status
+	case errors.Is(err, inventory.ErrInsufficientStock):
+		return http.StatusConflict
+	case errors.Is(err, inventory.ErrInvalidMovement):
+		return http.StatusBadRequest
+	case errors.Is(err, inventory.ErrExpiredLot):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondError writes err as a JSON error response
+func respondError(c *gin.Context, err error) {
+	c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+}
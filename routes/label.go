@@ -0,0 +1,195 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aldhipradana/warehouse-api/label"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterLabelRoutes sets up the bin, product and package label routes
+func RegisterLabelRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	labels := rg.Group("/labels")
+	labels.Use(middleware.AuthMiddleware())
+	{
+		labels.GET("/templates", labelTemplatesHandler())
+		labels.GET("/bins/:id", binLabelHandler(db))
+		labels.GET("/products/:id", productLabelHandler(db))
+		labels.GET("/packages/:id", packageLabelHandler(db))
+	}
+}
+
+// binLabel is the data available to bin label templates
+type binLabel struct {
+	Code          string
+	Type          string
+	Zone          string
+	Warehouse     string
+	WarehouseName string
+}
+
+// productLabel is the data available to product label templates.
+// Barcode is the first barcode of the product, or its SKU when it has none.
+type productLabel struct {
+	SKU      string
+	Name     string
+	Price    string
+	Barcode  string
+	Category string
+}
+
+// packageLabel is the data available to package label templates.
+// TrackingNumber falls back to the shipment's when the package has none.
+type packageLabel struct {
+	Shipment       string
+	Order          string
+	Customer       string
+	CustomerCode   string
+	Carrier        string
+	Service        string
+	TrackingNumber string
+	Package        int
+	Packages       int
+	Weight         float64
+}
+
+// labelTemplatesHandler lists the configured label templates
+func labelTemplatesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"dpi": label.DPI(), "data": label.Templates()})
+	}
+}
+
+func binLabelHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var bin models.BinLocation
+		if err := db.Preload("Warehouse").Preload("Zone").First(&bin, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Bin location not found"})
+			return
+		}
+
+		data := binLabel{Code: bin.Code, Type: bin.Type}
+		if bin.Zone != nil {
+			data.Zone = bin.Zone.Code
+		}
+		if bin.Warehouse != nil {
+			data.Warehouse, data.WarehouseName = bin.Warehouse.Code, bin.Warehouse.Name
+		}
+		writeLabel(c, label.KindBin, "bin-"+bin.Code, data)
+	}
+}
+
+func productLabelHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var product models.Product
+		err := db.Preload("Category").Preload("Barcodes", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).
+			First(&product, "id = ?", c.Param("id")).Error
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		data := productLabel{SKU: product.SKU, Name: product.Name, Price: models.FormatAmount(product.PriceAmount, product.Currency) + " " + product.Currency, Barcode: product.SKU}
+		if len(product.Barcodes) > 0 {
+			data.Barcode = product.Barcodes[0].Code
+		}
+		if product.Category != nil {
+			data.Category = product.Category.Name
+		}
+		writeLabel(c, label.KindProduct, "product-"+product.SKU, data)
+	}
+}
+
+func packageLabelHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var pkg models.Package
+		if err := db.First(&pkg, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Package not found"})
+			return
+		}
+		var shipment models.Shipment
+		err := db.Preload("SalesOrder.Customer").Preload("Packages", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).
+			First(&shipment, pkg.ShipmentID).Error
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+			return
+		}
+
+		data := packageLabel{
+			Shipment:       shipment.Number,
+			Carrier:        shipment.Carrier,
+			Service:        shipment.Service,
+			TrackingNumber: pkg.TrackingNumber,
+			Packages:       len(shipment.Packages),
+			Weight:         pkg.Weight,
+		}
+		if data.TrackingNumber == "" {
+			data.TrackingNumber = shipment.TrackingNumber
+		}
+		for i, p := range shipment.Packages {
+			if p.ID == pkg.ID {
+				data.Package = i + 1
+			}
+		}
+		if order := shipment.SalesOrder; order != nil {
+			data.Order = order.Number
+			if order.Customer != nil {
+				data.Customer, data.CustomerCode = order.Customer.Name, order.Customer.Code
+			}
+		}
+		writeLabel(c, label.KindPackage, fmt.Sprintf("package-%s-%d", shipment.Number, data.Package), data)
+	}
+}
+
+// writeLabel renders the template chosen with ?template= (default: the kind
+// itself) in the ?format= requested: png (default), pdf or zpl
+func writeLabel(c *gin.Context, kind, filename string, data interface{}) {
+	l, err := label.Render(c.DefaultQuery("template", kind), kind, data)
+	if err != nil {
+		labelError(c, err)
+		return
+	}
+
+	var body []byte
+	var contentType string
+	format := c.DefaultQuery("format", "png")
+	switch format {
+	case "png":
+		body, err = l.PNG()
+		contentType = "image/png"
+	case "pdf":
+		body, err = l.PDF()
+		contentType = "application/pdf"
+	case "zpl":
+		var program string
+		program, err = l.ZPL()
+		body, contentType = []byte(program), "application/zpl"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be png, pdf or zpl"})
+		return
+	}
+	if err != nil {
+		labelError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename+"."+format))
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// labelError maps label errors to HTTP status codes
+func labelError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, label.ErrUnknownTemplate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, label.ErrUnencodable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,370 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterPickingRoutes sets up the routes for waves and pick lists
+func RegisterPickingRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	waveCtrl := restful.NewCrudController[models.Wave](db)
+	pickListCtrl := restful.NewCrudController[models.PickList](db)
+
+	waves := rg.Group("/waves")
+	waves.Use(middleware.AuthMiddleware())
+	{
+		waves.GET("", waveCtrl.Index)
+		waves.GET("/:id", showWaveHandler(db))
+		waves.GET("/:id/lines", waveLinesHandler(db))
+		waves.POST("", createWaveHandler(db))
+	}
+
+	pickLists := rg.Group("/pick-lists")
+	pickLists.Use(middleware.AuthMiddleware())
+	{
+		pickLists.GET("", pickListCtrl.Index)
+		pickLists.GET("/:id", showPickListHandler(db))
+		pickLists.POST("/:id/lines/:line_id/confirm", confirmPickLineHandler(db))
+	}
+}
+
+// pickCandidate is a reservation in a storage bin that still has to be picked
+type pickCandidate struct {
+	StockReservationID uint
+	SalesOrderLineID   uint
+	SalesOrderID       uint
+	ProductID          uint
+	BinLocationID      uint
+	LotID              uint
+	Quantity           float64
+}
+
+// createWaveHandler generates a wave with one pick list per confirmed or partially
+// shipped sales order. Lines are numbered along the bin walking path (zone, pick
+// sequence, bin code) across the whole wave so one picker can work the wave in a
+// single pass.
+func createWaveHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			SalesOrderIDs        []uint `json:"sales_order_ids" binding:"required,min=1"`
+			StagingBinLocationID uint   `json:"staging_bin_location_id"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var wave models.Wave
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			var orders []models.SalesOrder
+			if err := inventory.ForUpdate(tx).Where("id IN ?", input.SalesOrderIDs).Order("id").Find(&orders).Error; err != nil {
+				return err
+			}
+			if len(orders) != len(uniqueIDs(input.SalesOrderIDs)) {
+				return newRequestError(http.StatusNotFound, "one or more sales orders not found")
+			}
+			for _, so := range orders {
+				if so.Status != models.SalesOrderConfirmed && so.Status != models.SalesOrderPartiallyShipped {
+					return newRequestError(http.StatusConflict, "sales order %s is %s, only confirmed or partially shipped orders can be picked", so.Number, so.Status)
+				}
+				if so.WarehouseID != orders[0].WarehouseID {
+					return newRequestError(http.StatusBadRequest, "all sales orders in a wave must ship from the same warehouse")
+				}
+			}
+
+			stagingID, err := stagingBin(tx, orders[0].WarehouseID, input.StagingBinLocationID)
+			if err != nil {
+				return err
+			}
+
+			var candidates []pickCandidate
+			err = tx.Table("stock_reservations").
+				Select("stock_reservations.id AS stock_reservation_id, stock_reservations.sales_order_line_id, "+
+					"sales_order_lines.sales_order_id, stock_reservations.product_id, stock_levels.bin_location_id, stock_levels.lot_id, stock_reservations.quantity").
+				Joins("JOIN sales_order_lines ON sales_order_lines.id = stock_reservations.sales_order_line_id").
+				Joins("JOIN stock_levels ON stock_levels.id = stock_reservations.stock_level_id").
+				Joins("JOIN bin_locations ON bin_locations.id = stock_levels.bin_location_id").
+				Joins("JOIN zones ON zones.id = bin_locations.zone_id").
+				Where("stock_reservations.deleted_at IS NULL AND sales_order_lines.sales_order_id IN ?", input.SalesOrderIDs).
+				Where("bin_locations.type <> ?", models.BinTypeStaging).
+				Where("NOT EXISTS (SELECT 1 FROM pick_list_lines WHERE pick_list_lines.stock_reservation_id = stock_reservations.id "+
+					"AND pick_list_lines.status = ? AND pick_list_lines.deleted_at IS NULL)", models.PickLinePending).
+				Order("zones.code, bin_locations.pick_sequence, bin_locations.code, stock_reservations.id").
+				Scan(&candidates).Error
+			if err != nil {
+				return err
+			}
+			if len(candidates) == 0 {
+				return newRequestError(http.StatusConflict, "nothing left to pick for the given sales orders")
+			}
+
+			pickLists := map[uint]*models.PickList{}
+			for i, candidate := range candidates {
+				pickList, ok := pickLists[candidate.SalesOrderID]
+				if !ok {
+					pickList = &models.PickList{SalesOrderID: candidate.SalesOrderID, Status: models.PickingOpen}
+					pickLists[candidate.SalesOrderID] = pickList
+				}
+				pickList.Lines = append(pickList.Lines, models.PickListLine{
+					SalesOrderLineID:   candidate.SalesOrderLineID,
+					StockReservationID: candidate.StockReservationID,
+					ProductID:          candidate.ProductID,
+					BinLocationID:      candidate.BinLocationID,
+					LotID:              candidate.LotID,
+					Sequence:           i + 1,
+					Quantity:           candidate.Quantity,
+					Status:             models.PickLinePending,
+				})
+			}
+
+			wave = models.Wave{
+				WarehouseID:          orders[0].WarehouseID,
+				StagingBinLocationID: stagingID,
+				Status:               models.PickingOpen,
+				UserID:               middleware.CurrentUserID(c),
+			}
+			for _, so := range orders {
+				if pickList, ok := pickLists[so.ID]; ok {
+					wave.PickLists = append(wave.PickLists, *pickList)
+				}
+			}
+			return tx.Create(&wave).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, wave)
+	}
+}
+
+// showWaveHandler returns a wave with its pick lists and their lines in walking order
+func showWaveHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var wave models.Wave
+		err := db.Preload("StagingBinLocation").
+			Preload("PickLists.Lines", orderBySequence).
+			Preload("PickLists.Lines.BinLocation").
+			Preload("PickLists.Lines.Product").
+			Preload("PickLists.Lines.Lot").
+			First(&wave, "id = ?", c.Param("id")).Error
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Wave not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, wave)
+	}
+}
+
+// waveLinesHandler returns every pick line of a wave as a single walking route
+func waveLinesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var wave models.Wave
+		if err := db.First(&wave, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Wave not found"})
+			return
+		}
+
+		var lines []models.PickListLine
+		err := db.Preload("BinLocation").Preload("Product").Preload("Lot").
+			Where("pick_list_id IN (?)", db.Model(&models.PickList{}).Select("id").Where("wave_id = ?", wave.ID)).
+			Order("sequence").
+			Find(&lines).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": lines})
+	}
+}
+
+// showPickListHandler returns a pick list with its lines in walking order
+func showPickListHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var pickList models.PickList
+		err := db.Preload("SalesOrder").
+			Preload("Lines", orderBySequence).
+			Preload("Lines.BinLocation").
+			Preload("Lines.Product").
+			Preload("Lines.Lot").
+			First(&pickList, "id = ?", c.Param("id")).Error
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pick list not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, pickList)
+	}
+}
+
+// confirmPickLineHandler records the quantity picked for a line. Picked stock
+// moves from the bin to the wave's staging location and stays reserved for the
+// order there. The unpicked remainder of a short pick is reserved again in
+// other bins of the warehouse, ready for a later wave, or backordered on the
+// sales order line when no other stock is available.
+func confirmPickLineHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Quantity      *float64 `json:"quantity" binding:"required,gte=0"`
+			SerialNumbers []string `json:"serial_numbers"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		picked := *input.Quantity
+
+		var line models.PickListLine
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			var pickList models.PickList
+			if err := inventory.ForUpdate(tx).First(&pickList, "id = ?", c.Param("id")).Error; err != nil {
+				return newRequestError(http.StatusNotFound, "Pick list not found")
+			}
+			if err := tx.First(&line, "id = ? AND pick_list_id = ?", c.Param("line_id"), pickList.ID).Error; err != nil {
+				return newRequestError(http.StatusNotFound, "Pick list line not found")
+			}
+			if line.Status != models.PickLinePending {
+				return newRequestError(http.StatusConflict, "line %d has already been confirmed", line.ID)
+			}
+			if picked > line.Quantity {
+				return newRequestError(http.StatusBadRequest, "picked quantity %g exceeds the %g to pick", picked, line.Quantity)
+			}
+
+			var wave models.Wave
+			if err := tx.First(&wave, pickList.WaveID).Error; err != nil {
+				return err
+			}
+			var soLine models.SalesOrderLine
+			if err := tx.First(&soLine, line.SalesOrderLineID).Error; err != nil {
+				return err
+			}
+			var reservation models.StockReservation
+			if err := tx.First(&reservation, line.StockReservationID).Error; err != nil {
+				return newRequestError(http.StatusConflict, "the reservation for line %d no longer exists, was the order cancelled?", line.ID)
+			}
+
+			if err := inventory.Unreserve(tx, &reservation, line.Quantity); err != nil {
+				return err
+			}
+
+			if picked > 0 {
+				movement := models.StockMovement{
+					Type:              models.MovementTransfer,
+					ProductID:         line.ProductID,
+					FromBinLocationID: &line.BinLocationID,
+					ToBinLocationID:   &wave.StagingBinLocationID,
+					Quantity:          picked,
+					SerialNumbers:     input.SerialNumbers,
+					Reason:            fmt.Sprintf("Picked for %s", pickList.Number),
+					ReferenceType:     models.ReferenceSalesOrder,
+					ReferenceID:       pickList.SalesOrderID,
+					UserID:            middleware.CurrentUserID(c),
+				}
+				if line.LotID != 0 {
+					movement.LotID = &line.LotID
+				}
+				if err := inventory.Post(tx, &movement); err != nil {
+					return err
+				}
+				if err := inventory.ReserveInBin(tx, &soLine, wave.StagingBinLocationID, line.LotID, picked); err != nil {
+					return err
+				}
+				if err := tx.Model(&soLine).Update("picked_quantity", gorm.Expr("picked_quantity + ?", picked)).Error; err != nil {
+					return err
+				}
+			}
+
+			if shortfall := line.Quantity - picked; shortfall > 0 {
+				if err := inventory.ReserveElsewhereOrBackorder(tx, &soLine, wave.WarehouseID, line.BinLocationID, shortfall); err != nil {
+					return err
+				}
+			}
+
+			line.PickedQuantity = picked
+			line.SerialNumbers = input.SerialNumbers
+			line.Status = models.PickLinePicked
+			if picked < line.Quantity {
+				line.Status = models.PickLineShort
+			}
+			if err := tx.Model(&line).Select("picked_quantity", "serial_numbers", "status").Updates(&line).Error; err != nil {
+				return err
+			}
+
+			return completePicking(tx, &pickList, &wave)
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, line)
+	}
+}
+
+// completePicking closes the pick list and its wave once no lines are pending
+func completePicking(tx *gorm.DB, pickList *models.PickList, wave *models.Wave) error {
+	var pending int64
+	tx.Model(&models.PickListLine{}).Where("pick_list_id = ? AND status = ?", pickList.ID, models.PickLinePending).Count(&pending)
+	if pending > 0 {
+		return nil
+	}
+	if err := tx.Model(pickList).Update("status", models.PickingCompleted).Error; err != nil {
+		return err
+	}
+
+	var open int64
+	tx.Model(&models.PickList{}).Where("wave_id = ? AND status = ?", wave.ID, models.PickingOpen).Count(&open)
+	if open > 0 {
+		return nil
+	}
+	return tx.Model(wave).Update("status", models.PickingCompleted).Error
+}
+
+// stagingBin resolves the staging bin for a warehouse, defaulting to the first staging bin
+func stagingBin(tx *gorm.DB, warehouseID, binID uint) (uint, error) {
+	return binOfType(tx, warehouseID, binID, models.BinTypeStaging)
+}
+
+// binOfType resolves a bin of the given type in a warehouse, defaulting to
+// the first bin of that type when binID is 0
+func binOfType(tx *gorm.DB, warehouseID, binID uint, binType string) (uint, error) {
+	var bin models.BinLocation
+	query := tx.Where("warehouse_id = ? AND type = ?", warehouseID, binType)
+	if binID != 0 {
+		query = query.Where("id = ?", binID)
+	}
+	if err := query.Order("id").First(&bin).Error; err != nil {
+		return 0, newRequestError(http.StatusBadRequest, "no %s bin location found in warehouse %d", binType, warehouseID)
+	}
+	return bin.ID, nil
+}
+
+// orderBySequence sorts preloaded pick lines along the walking path
+func orderBySequence(db *gorm.DB) *gorm.DB {
+	return db.Order("sequence")
+}
+
+// uniqueIDs removes duplicate IDs from a request list
+func uniqueIDs(ids []uint) []uint {
+	seen := map[uint]bool{}
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
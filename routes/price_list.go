@@ -0,0 +1,206 @@
+package routes
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterPriceListRoutes sets up the routes for customer groups, price lists and exchange rates
+func RegisterPriceListRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	groupCtrl := restful.NewCrudController[models.CustomerGroup](db)
+	listCtrl := restful.NewCrudController[models.PriceList](db)
+	itemCtrl := restful.NewCrudController[models.PriceListItem](db)
+	rateCtrl := restful.NewCrudController[models.ExchangeRate](db)
+
+	groups := rg.Group("/customer-groups")
+	groups.Use(middleware.AuthMiddleware())
+	{
+		groups.GET("", groupCtrl.Index)
+		groups.GET("/:id", groupCtrl.Show)
+		groups.POST("", groupCtrl.Store)
+		groups.PUT("/:id", groupCtrl.Update)
+		groups.DELETE("/:id", groupCtrl.Destroy)
+	}
+
+	lists := rg.Group("/price-lists")
+	lists.Use(middleware.AuthMiddleware())
+	{
+		lists.GET("", listCtrl.Index)
+		lists.GET("/:id", listCtrl.Show)
+		lists.POST("", listCtrl.Store)
+		lists.PUT("/:id", listCtrl.Update)
+		lists.DELETE("/:id", listCtrl.Destroy)
+	}
+
+	items := rg.Group("/price-list-items")
+	items.Use(middleware.AuthMiddleware())
+	{
+		items.GET("", itemCtrl.Index)
+		items.GET("/:id", itemCtrl.Show)
+		items.POST("", itemCtrl.Store)
+		items.PUT("/:id", itemCtrl.Update)
+		items.DELETE("/:id", itemCtrl.Destroy)
+	}
+
+	rates := rg.Group("/exchange-rates")
+	rates.Use(middleware.AuthMiddleware())
+	{
+		rates.GET("", rateCtrl.Index)
+		rates.GET("/:id", rateCtrl.Show)
+		rates.POST("", rateCtrl.Store)
+		rates.PUT("/:id", rateCtrl.Update)
+		rates.DELETE("/:id", rateCtrl.Destroy)
+	}
+}
+
+// productPrice is the resolved price of a product for a customer, quantity
+// and date. Amounts are in minor units of Currency.
+type productPrice struct {
+	ProductID       uint    `json:"product_id"`
+	CustomerID      *uint   `json:"customer_id"`
+	CustomerGroupID *uint   `json:"customer_group_id"`
+	Quantity        float64 `json:"quantity"`
+	Date            string  `json:"date"`
+	Source          string  `json:"source"`
+	PriceListID     *uint   `json:"price_list_id"`
+	PriceListItemID *uint   `json:"price_list_item_id"`
+	MinQuantity     float64 `json:"min_quantity"`
+	Currency        string  `json:"currency"`
+	UnitPriceAmount int64   `json:"unit_price_amount"`
+	TotalAmount     int64   `json:"total_amount"`
+	UnitPrice       string  `json:"unit_price"`
+	Total           string  `json:"total"`
+	// Set when the price was converted from the currency it is kept in
+	PriceCurrency string   `json:"price_currency,omitempty"`
+	ExchangeRate  *float64 `json:"exchange_rate,omitempty"`
+}
+
+// productPriceHandler resolves the unit price of a product. The customer
+// (ID or code) brings in the price lists of its group, qty (base units,
+// default 1) picks the quantity break and date (default today) the lists and
+// exchange rate in effect. Without an applicable price list the product's
+// own price applies. currency converts the result at the exchange rate.
+func productPriceHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var product models.Product
+		if err := db.First(&product, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		quantity := 1.0
+		if value := c.Query("qty"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "qty must be a positive number"})
+				return
+			}
+			quantity = parsed
+		}
+
+		day := time.Now()
+		if value := c.Query("date"); value != "" {
+			date, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "date must be a date (YYYY-MM-DD)"})
+				return
+			}
+			day = date
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+		end := day.AddDate(0, 0, 1)
+
+		result := productPrice{
+			ProductID:       product.ID,
+			Quantity:        quantity,
+			Date:            day.Format(time.DateOnly),
+			Source:          "product",
+			Currency:        product.Currency,
+			UnitPriceAmount: product.PriceAmount,
+		}
+
+		if value := c.Query("customer"); value != "" {
+			query := db.Where("code = ?", value)
+			if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+				query = db.Where("code = ? OR id = ?", value, id)
+			}
+			var customer models.Customer
+			if err := query.First(&customer).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+				return
+			}
+			result.CustomerID = &customer.ID
+			result.CustomerGroupID = customer.CustomerGroupID
+		}
+
+		// The best item: highest list priority, then the customer's group
+		// over lists for everyone, then the largest quantity break reached
+		query := db.Model(&models.PriceListItem{}).
+			Select("price_list_items.*").
+			Joins("JOIN price_lists ON price_lists.id = price_list_items.price_list_id AND price_lists.deleted_at IS NULL").
+			Where("price_list_items.product_id = ? AND price_list_items.min_quantity <= ?", product.ID, quantity).
+			Where("price_lists.valid_from IS NULL OR price_lists.valid_from < ?", end).
+			Where("price_lists.valid_to IS NULL OR price_lists.valid_to >= ?", day)
+		if result.CustomerGroupID != nil {
+			query = query.Where("price_lists.customer_group_id IS NULL OR price_lists.customer_group_id = ?", *result.CustomerGroupID)
+		} else {
+			query = query.Where("price_lists.customer_group_id IS NULL")
+		}
+		var item models.PriceListItem
+		err := query.Preload("PriceList").
+			Order("price_lists.priority DESC").
+			Order("CASE WHEN price_lists.customer_group_id IS NULL THEN 1 ELSE 0 END").
+			Order("price_list_items.min_quantity DESC, price_lists.id DESC").
+			Limit(1).
+			Find(&item).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if item.ID != 0 {
+			result.Source = "price_list"
+			result.PriceListID = &item.PriceListID
+			result.PriceListItemID = &item.ID
+			result.MinQuantity = item.MinQuantity
+			result.Currency = item.PriceList.Currency
+			result.UnitPriceAmount = item.PriceAmount
+		}
+
+		if value := c.Query("currency"); value != "" {
+			currency, err := models.NormalizeCurrency(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if currency != result.Currency {
+				rate, err := models.FindExchangeRate(db, result.Currency, currency, end.Add(-time.Nanosecond))
+				if errors.Is(err, models.ErrNoExchangeRate) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "No exchange rate from " + result.Currency + " to " + currency + " on " + result.Date})
+					return
+				}
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				result.PriceCurrency = result.Currency
+				result.ExchangeRate = &rate
+				result.UnitPriceAmount = models.ConvertAmount(result.UnitPriceAmount, result.Currency, currency, rate)
+				result.Currency = currency
+			}
+		}
+
+		result.TotalAmount = int64(math.Round(float64(result.UnitPriceAmount) * quantity))
+		result.UnitPrice = models.FormatAmount(result.UnitPriceAmount, result.Currency)
+		result.Total = models.FormatAmount(result.TotalAmount, result.Currency)
+		c.JSON(http.StatusOK, gin.H{"data": result})
+	}
+}
@@ -20,5 +20,10 @@ func RegisterProductRoutes(rg *gin.RouterGroup, db *gorm.DB) {
 		products.POST("", productCtrl.Store)
 		products.PUT("/:id", productCtrl.Update)
 		products.DELETE("/:id", productCtrl.Destroy)
+		products.GET("/:id/stock", productStockHandler(db))
+		products.GET("/:id/units", productUnitsHandler(db))
+		products.POST("/:id/variants", generateVariantsHandler(db))
+		products.GET("/:id/availability", productAvailabilityHandler(db))
+		products.GET("/:id/price", productPriceHandler(db))
 	}
 }
@@ -0,0 +1,386 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterPurchaseOrderRoutes sets up the routes for suppliers and purchase orders
+func RegisterPurchaseOrderRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	supplierCtrl := restful.NewCrudController[models.Supplier](db)
+	poCtrl := restful.NewCrudController[models.PurchaseOrder](db)
+
+	suppliers := rg.Group("/suppliers")
+	suppliers.Use(middleware.AuthMiddleware())
+	{
+		suppliers.GET("", supplierCtrl.Index)
+		suppliers.GET("/:id", supplierCtrl.Show)
+		suppliers.POST("", supplierCtrl.Store)
+		suppliers.PUT("/:id", supplierCtrl.Update)
+		suppliers.DELETE("/:id", supplierCtrl.Destroy)
+	}
+
+	orders := rg.Group("/purchase-orders")
+	orders.Use(middleware.AuthMiddleware())
+	{
+		orders.GET("", poCtrl.Index)
+		orders.GET("/:id", poCtrl.Show)
+		orders.POST("", storePurchaseOrderHandler(db))
+		orders.PUT("/:id", updatePurchaseOrderHandler(db))
+		orders.DELETE("/:id", destroyPurchaseOrderHandler(db))
+
+		// Lifecycle transitions
+		orders.POST("/:id/submit", purchaseOrderTransitionHandler(db, models.PurchaseOrderSubmitted))
+		orders.POST("/:id/cancel", purchaseOrderTransitionHandler(db, models.PurchaseOrderCancelled))
+		orders.POST("/:id/close", purchaseOrderTransitionHandler(db, models.PurchaseOrderClosed))
+		orders.POST("/:id/receive", receivePurchaseOrderHandler(db))
+	}
+}
+
+// purchaseOrderInput is the request body for creating or updating a draft purchase order
+type purchaseOrderInput struct {
+	SupplierID  uint       `json:"supplier_id" binding:"required"`
+	WarehouseID uint       `json:"warehouse_id" binding:"required"`
+	ExpectedAt  *time.Time `json:"expected_at"`
+	Notes       string     `json:"notes"`
+	Lines       []struct {
+		ProductID       uint    `json:"product_id" binding:"required"`
+		Quantity        float64 `json:"quantity" binding:"required,gt=0"`
+		UnitOfMeasureID uint    `json:"unit_of_measure_id"`
+		UnitCost        float64 `json:"unit_cost" binding:"gte=0"`
+	} `json:"lines" binding:"required,min=1,dive"`
+}
+
+// validate checks that the supplier, warehouse and products referenced by the input exist
+func (input *purchaseOrderInput) validate(tx *gorm.DB) error {
+	var count int64
+	if tx.Model(&models.Supplier{}).Where("id = ?", input.SupplierID).Count(&count); count == 0 {
+		return newRequestError(http.StatusBadRequest, "supplier %d not found", input.SupplierID)
+	}
+	if tx.Model(&models.Warehouse{}).Where("id = ?", input.WarehouseID).Count(&count); count == 0 {
+		return newRequestError(http.StatusBadRequest, "warehouse %d not found", input.WarehouseID)
+	}
+	for _, line := range input.Lines {
+		if tx.Model(&models.Product{}).Where("id = ?", line.ProductID).Count(&count); count == 0 {
+			return newRequestError(http.StatusBadRequest, "product %d not found", line.ProductID)
+		}
+	}
+	return nil
+}
+
+// lines converts the input lines into purchase order lines, normalizing the
+// ordered quantity to the product's base unit
+func (input *purchaseOrderInput) lines(tx *gorm.DB) ([]models.PurchaseOrderLine, error) {
+	lines := make([]models.PurchaseOrderLine, 0, len(input.Lines))
+	for _, line := range input.Lines {
+		quantity, err := models.ToBaseQuantity(tx, line.ProductID, line.UnitOfMeasureID, line.Quantity)
+		if err != nil {
+			return nil, newRequestError(http.StatusBadRequest, "%s", err.Error())
+		}
+		lines = append(lines, models.PurchaseOrderLine{
+			ProductID:       line.ProductID,
+			Quantity:        quantity,
+			UnitOfMeasureID: optionalID(line.UnitOfMeasureID),
+			UnitQuantity:    line.Quantity,
+			UnitCost:        line.UnitCost,
+		})
+	}
+	return lines, nil
+}
+
+// storePurchaseOrderHandler creates a purchase order in draft status
+func storePurchaseOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input purchaseOrderInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		po := models.PurchaseOrder{
+			SupplierID:  input.SupplierID,
+			WarehouseID: input.WarehouseID,
+			Status:      models.PurchaseOrderDraft,
+			ExpectedAt:  input.ExpectedAt,
+			Notes:       input.Notes,
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := input.validate(tx); err != nil {
+				return err
+			}
+			lines, err := input.lines(tx)
+			if err != nil {
+				return err
+			}
+			po.Lines = lines
+			return tx.Create(&po).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, po)
+	}
+}
+
+// updatePurchaseOrderHandler replaces the header and lines of a draft purchase order
+func updatePurchaseOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input purchaseOrderInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var po models.PurchaseOrder
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockPurchaseOrder(tx, c.Param("id"), &po); err != nil {
+				return err
+			}
+			if po.Status != models.PurchaseOrderDraft {
+				return newRequestError(http.StatusConflict, "only draft purchase orders can be edited")
+			}
+			if err := input.validate(tx); err != nil {
+				return err
+			}
+			lines, err := input.lines(tx)
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Where("purchase_order_id = ?", po.ID).Delete(&models.PurchaseOrderLine{}).Error; err != nil {
+				return err
+			}
+
+			po.SupplierID = input.SupplierID
+			po.WarehouseID = input.WarehouseID
+			po.ExpectedAt = input.ExpectedAt
+			po.Notes = input.Notes
+			po.Lines = lines
+			return tx.Save(&po).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, po)
+	}
+}
+
+// destroyPurchaseOrderHandler deletes a draft purchase order and its lines
+func destroyPurchaseOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var po models.PurchaseOrder
+			if err := lockPurchaseOrder(tx, c.Param("id"), &po); err != nil {
+				return err
+			}
+			if po.Status != models.PurchaseOrderDraft {
+				return newRequestError(http.StatusConflict, "only draft purchase orders can be deleted, cancel it instead")
+			}
+			if err := tx.Where("purchase_order_id = ?", po.ID).Delete(&models.PurchaseOrderLine{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&po).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Success"})
+	}
+}
+
+// purchaseOrderTransitionHandler moves a purchase order to the given status
+func purchaseOrderTransitionHandler(db *gorm.DB, status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var po models.PurchaseOrder
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockPurchaseOrder(tx, c.Param("id"), &po); err != nil {
+				return err
+			}
+			if !po.CanTransitionTo(status) {
+				return newRequestError(http.StatusConflict, "cannot move purchase order from %s to %s", po.Status, status)
+			}
+			po.Status = status
+			return tx.Model(&po).Update("status", status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, po)
+	}
+}
+
+// receivePurchaseOrderHandler books received quantities into stock per line.
+// Quantities above the ordered amount are accepted and flagged while they
+// stay within the supplier's over-receipt tolerance, and rejected beyond it.
+func receivePurchaseOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			BinLocationID uint `json:"bin_location_id"`
+			Lines         []struct {
+				LineID          uint       `json:"line_id" binding:"required"`
+				Quantity        float64    `json:"quantity" binding:"required,gt=0"`
+				UnitOfMeasureID *uint      `json:"unit_of_measure_id"`
+				BinLocationID   uint       `json:"bin_location_id"`
+				LotNumber       string     `json:"lot_number"`
+				ExpiresAt       *time.Time `json:"expires_at"`
+				SerialNumbers   []string   `json:"serial_numbers"`
+			} `json:"lines" binding:"required,min=1,dive"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var po models.PurchaseOrder
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			if err := lockPurchaseOrder(tx, c.Param("id"), &po); err != nil {
+				return err
+			}
+			if po.Status != models.PurchaseOrderSubmitted && po.Status != models.PurchaseOrderPartiallyReceived {
+				return newRequestError(http.StatusConflict, "cannot receive a purchase order in status %s", po.Status)
+			}
+
+			var supplier models.Supplier
+			if err := tx.First(&supplier, po.SupplierID).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("purchase_order_id = ?", po.ID).Order("id").Find(&po.Lines).Error; err != nil {
+				return err
+			}
+
+			for _, received := range input.Lines {
+				line := findPurchaseOrderLine(po.Lines, received.LineID)
+				if line == nil {
+					return newRequestError(http.StatusBadRequest, "line %d does not belong to purchase order %s", received.LineID, po.Number)
+				}
+
+				binID := received.BinLocationID
+				if binID == 0 {
+					binID = input.BinLocationID
+				}
+				if err := requireWarehouseBin(tx, po.WarehouseID, binID); err != nil {
+					return err
+				}
+
+				// Quantities are received in the line's unit unless another unit is given
+				var unitID uint
+				if received.UnitOfMeasureID != nil {
+					unitID = *received.UnitOfMeasureID
+				} else if line.UnitOfMeasureID != nil {
+					unitID = *line.UnitOfMeasureID
+				}
+				quantity, err := models.ToBaseQuantity(tx, line.ProductID, unitID, received.Quantity)
+				if err != nil {
+					return newRequestError(http.StatusBadRequest, "%s", err.Error())
+				}
+
+				line.ReceivedQuantity += quantity
+				if line.ReceivedQuantity > line.Quantity {
+					limit := line.Quantity * (1 + supplier.OverReceiptTolerance/100)
+					if line.ReceivedQuantity > limit {
+						return newRequestError(http.StatusUnprocessableEntity,
+							"line %d would be over-received: %g of %g ordered exceeds the %g%% tolerance of supplier %s",
+							line.ID, line.ReceivedQuantity, line.Quantity, supplier.OverReceiptTolerance, supplier.Code)
+					}
+					line.OverReceived = true
+				}
+
+				if err := tx.Model(line).Updates(map[string]interface{}{
+					"received_quantity": line.ReceivedQuantity,
+					"over_received":     line.OverReceived,
+				}).Error; err != nil {
+					return err
+				}
+
+				movement := models.StockMovement{
+					Type:            models.MovementReceive,
+					ProductID:       line.ProductID,
+					ToBinLocationID: &binID,
+					Quantity:        quantity,
+					LotNumber:       received.LotNumber,
+					ExpiresAt:       received.ExpiresAt,
+					SerialNumbers:   received.SerialNumbers,
+					Reason:          fmt.Sprintf("Receipt for %s", po.Number),
+					ReferenceType:   models.ReferencePurchaseOrder,
+					ReferenceID:     po.ID,
+					UserID:          middleware.CurrentUserID(c),
+				}
+				// The line is priced per ordered unit, the ledger is valued per base unit
+				if line.Quantity > 0 {
+					movement.UnitCost = line.UnitCost * line.UnitQuantity / line.Quantity
+				}
+				if err := inventory.Post(tx, &movement); err != nil {
+					return err
+				}
+			}
+
+			status := models.PurchaseOrderReceived
+			for _, line := range po.Lines {
+				if line.ReceivedQuantity < line.Quantity {
+					status = models.PurchaseOrderPartiallyReceived
+					break
+				}
+			}
+			if status == po.Status {
+				return nil
+			}
+			po.Status = status
+			return tx.Model(&po).Update("status", status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, po)
+	}
+}
+
+// lockPurchaseOrder loads a purchase order and locks its row for the rest of the transaction
+func lockPurchaseOrder(tx *gorm.DB, id string, po *models.PurchaseOrder) error {
+	if err := inventory.ForUpdate(tx).First(po, "id = ?", id).Error; err != nil {
+		return newRequestError(http.StatusNotFound, "Purchase order not found")
+	}
+	return nil
+}
+
+// findPurchaseOrderLine returns the line with the given ID, or nil
+func findPurchaseOrderLine(lines []models.PurchaseOrderLine, id uint) *models.PurchaseOrderLine {
+	for i := range lines {
+		if lines[i].ID == id {
+			return &lines[i]
+		}
+	}
+	return nil
+}
+
+// requireWarehouseBin checks that a bin location exists inside the given warehouse
+func requireWarehouseBin(tx *gorm.DB, warehouseID, binID uint) error {
+	if binID == 0 {
+		return newRequestError(http.StatusBadRequest, "bin_location_id is required")
+	}
+	var count int64
+	tx.Model(&models.BinLocation{}).Where("id = ? AND warehouse_id = ?", binID, warehouseID).Count(&count)
+	if count == 0 {
+		return newRequestError(http.StatusBadRequest, "bin location %d is not in warehouse %d", binID, warehouseID)
+	}
+	return nil
+}
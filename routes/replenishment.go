@@ -0,0 +1,167 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterReplenishmentRoutes sets up the routes for reorder rules and replenishment suggestions
+func RegisterReplenishmentRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	ruleCtrl := restful.NewCrudController[models.ReorderRule](db)
+
+	rules := rg.Group("/reorder-rules")
+	rules.Use(middleware.AuthMiddleware())
+	{
+		rules.GET("", ruleCtrl.Index)
+		rules.GET("/:id", ruleCtrl.Show)
+		rules.POST("", ruleCtrl.Store)
+		rules.PUT("/:id", ruleCtrl.Update)
+		rules.DELETE("/:id", ruleCtrl.Destroy)
+	}
+
+	replenishment := rg.Group("/replenishment")
+	replenishment.Use(middleware.AuthMiddleware())
+	{
+		replenishment.GET("/suggestions", suggestionsHandler(db))
+		replenishment.POST("/purchase-orders", createSuggestedPurchaseOrdersHandler(db))
+	}
+}
+
+// supplierSuggestions groups replenishment suggestions under their preferred supplier
+type supplierSuggestions struct {
+	SupplierID   *uint                  `json:"supplier_id"`
+	SupplierCode string                 `json:"supplier_code"`
+	SupplierName string                 `json:"supplier_name"`
+	Lines        []inventory.Suggestion `json:"lines"`
+}
+
+// suggestionsHandler returns what to buy per preferred supplier. Products
+// without a preferred supplier are grouped under a null supplier.
+func suggestionsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		warehouseID, err := strconv.ParseUint(c.DefaultQuery("warehouse_id", "0"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse_id"})
+			return
+		}
+
+		suggestions, err := inventory.Suggestions(db, uint(warehouseID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		groups := []supplierSuggestions{}
+		index := map[uint]int{}
+		for _, suggestion := range suggestions {
+			var key uint
+			if suggestion.SupplierID != nil {
+				key = *suggestion.SupplierID
+			}
+			i, ok := index[key]
+			if !ok {
+				group := supplierSuggestions{SupplierID: suggestion.SupplierID}
+				if suggestion.SupplierID != nil {
+					var supplier models.Supplier
+					if err := db.First(&supplier, *suggestion.SupplierID).Error; err == nil {
+						group.SupplierCode = supplier.Code
+						group.SupplierName = supplier.Name
+					}
+				}
+				i = len(groups)
+				index[key] = i
+				groups = append(groups, group)
+			}
+			groups[i].Lines = append(groups[i].Lines, suggestion)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": groups})
+	}
+}
+
+// createSuggestedPurchaseOrdersHandler turns the current suggestions into
+// draft purchase orders, one per supplier and warehouse. Suggestions without
+// a preferred supplier are returned as skipped.
+func createSuggestedPurchaseOrdersHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			WarehouseID uint   `json:"warehouse_id"`
+			SupplierIDs []uint `json:"supplier_ids"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		onlySuppliers := map[uint]bool{}
+		for _, id := range input.SupplierIDs {
+			onlySuppliers[id] = true
+		}
+
+		orders := []models.PurchaseOrder{}
+		skipped := []inventory.Suggestion{}
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			suggestions, err := inventory.Suggestions(tx, input.WarehouseID)
+			if err != nil {
+				return err
+			}
+
+			index := map[[2]uint]int{}
+			for _, suggestion := range suggestions {
+				if suggestion.SupplierID == nil {
+					skipped = append(skipped, suggestion)
+					continue
+				}
+				if len(onlySuppliers) > 0 && !onlySuppliers[*suggestion.SupplierID] {
+					continue
+				}
+
+				key := [2]uint{*suggestion.SupplierID, suggestion.WarehouseID}
+				i, ok := index[key]
+				if !ok {
+					i = len(orders)
+					index[key] = i
+					orders = append(orders, models.PurchaseOrder{
+						SupplierID:  *suggestion.SupplierID,
+						WarehouseID: suggestion.WarehouseID,
+						Status:      models.PurchaseOrderDraft,
+						Notes:       "Created from replenishment suggestions",
+					})
+				}
+				// Lines are ordered in the base unit at the current unit cost
+				cost, err := inventory.UnitCost(tx, suggestion.ProductID, suggestion.WarehouseID)
+				if err != nil {
+					return err
+				}
+				orders[i].Lines = append(orders[i].Lines, models.PurchaseOrderLine{
+					ProductID:    suggestion.ProductID,
+					Quantity:     suggestion.SuggestedQuantity,
+					UnitQuantity: suggestion.SuggestedQuantity,
+					UnitCost:     cost,
+				})
+			}
+
+			for i := range orders {
+				if err := tx.Create(&orders[i]).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"data": orders, "skipped": skipped})
+	}
+}
@@ -0,0 +1,224 @@
+package routes
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterReportRoutes sets up the reporting routes
+func RegisterReportRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	reports := rg.Group("/reports")
+	reports.Use(middleware.AuthMiddleware())
+	{
+		reports.GET("/categories", categoryReportHandler(db))
+		reports.GET("/valuation", valuationReportHandler(db))
+	}
+}
+
+// categoryTotals is one row of the category rollup report
+type categoryTotals struct {
+	CategoryID *uint   `json:"category_id"`
+	Name       string  `json:"name"`
+	Path       string  `json:"path"`
+	Depth      int     `json:"depth"`
+	Products   int     `json:"products"`
+	Quantity   float64 `json:"quantity"`
+	Reserved   float64 `json:"reserved"`
+	Available  float64 `json:"available"`
+	InTransit  float64 `json:"in_transit"`
+}
+
+// categoryReportHandler rolls product counts and stock up to the categories
+// at the requested level of the tree (default 1, the root categories).
+// Products in a shallower category are reported under that category and
+// products without a category under a row with a null category_id.
+func categoryReportHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		level, err := strconv.Atoi(c.DefaultQuery("level", "1"))
+		if err != nil || level < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "level must be a positive number"})
+			return
+		}
+
+		var categories []models.Category
+		if err := db.Find(&categories).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		byID := map[uint]models.Category{}
+		for _, category := range categories {
+			byID[category.ID] = category
+		}
+
+		stock := db.Model(&models.StockLevel{}).
+			Select("stock_levels.product_id, "+
+				"SUM(CASE WHEN bin_locations.type = ? THEN 0 ELSE stock_levels.quantity END) AS quantity, "+
+				"SUM(stock_levels.reserved) AS reserved, "+
+				"SUM(CASE WHEN bin_locations.type = ? THEN stock_levels.quantity ELSE 0 END) AS in_transit",
+				models.BinTypeTransit, models.BinTypeTransit).
+			Joins("JOIN bin_locations ON bin_locations.id = stock_levels.bin_location_id").
+			Group("stock_levels.product_id")
+		if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+			stock = stock.Where("bin_locations.warehouse_id = ?", warehouseID)
+		}
+		var rows []struct {
+			CategoryID *uint
+			Quantity   float64
+			Reserved   float64
+			InTransit  float64
+		}
+		err = db.Model(&models.Product{}).
+			Select("products.category_id, COALESCE(stock.quantity, 0) AS quantity, COALESCE(stock.reserved, 0) AS reserved, "+
+				"COALESCE(stock.in_transit, 0) AS in_transit").
+			Joins("LEFT JOIN (?) AS stock ON stock.product_id = products.id", stock).
+			Scan(&rows).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		totals := map[uint]*categoryTotals{}
+		uncategorized := &categoryTotals{Name: "Uncategorized"}
+		report := []*categoryTotals{}
+		for _, row := range rows {
+			total := uncategorized
+			if category, ok := byID[derefID(row.CategoryID)]; ok {
+				// Walk up to the ancestor at the requested level
+				if ancestors := category.AncestorIDs(); len(ancestors) > level {
+					category = byID[ancestors[level-1]]
+				}
+				if total = totals[category.ID]; total == nil {
+					total = &categoryTotals{CategoryID: &category.ID, Name: category.Name, Path: category.Path, Depth: category.Depth}
+					totals[category.ID] = total
+					report = append(report, total)
+				}
+			}
+			total.Products++
+			total.Quantity += row.Quantity
+			total.Reserved += row.Reserved
+			total.Available = total.Quantity - total.Reserved
+			total.InTransit += row.InTransit
+		}
+		sort.Slice(report, func(i, j int) bool { return report[i].Name < report[j].Name })
+		if uncategorized.Products > 0 {
+			report = append(report, uncategorized)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"level": level, "data": report})
+	}
+}
+
+// valuationRow is the stock and value of one product in one warehouse
+type valuationRow struct {
+	ProductID     uint    `json:"product_id"`
+	SKU           string  `json:"sku"`
+	Name          string  `json:"name"`
+	WarehouseID   uint    `json:"warehouse_id"`
+	WarehouseCode string  `json:"warehouse_code"`
+	Quantity      float64 `json:"quantity"`
+	Value         float64 `json:"value"`
+	UnitCost      float64 `json:"unit_cost"`
+}
+
+// valuationReportHandler values the stock of every product per warehouse at
+// the end of the as_of date (default today) by replaying the costed ledger:
+// each movement adds its cost to the warehouse it enters and subtracts it
+// from the warehouse it leaves
+func valuationReportHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		asOf := time.Now()
+		if value := c.Query("as_of"); value != "" {
+			date, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "as_of must be a date (YYYY-MM-DD)"})
+				return
+			}
+			asOf = date.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+
+		side := func(binColumn string, sign string) *gorm.DB {
+			query := db.Model(&models.StockMovement{}).
+				Select("stock_movements.product_id, bin_locations.warehouse_id, "+
+					sign+"stock_movements.quantity AS quantity, "+sign+"stock_movements.cost_amount AS value").
+				Joins("JOIN bin_locations ON bin_locations.id = stock_movements."+binColumn).
+				Where("stock_movements.created_at <= ?", asOf)
+			if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+				query = query.Where("bin_locations.warehouse_id = ?", warehouseID)
+			}
+			if productID := c.Query("product_id"); productID != "" {
+				query = query.Where("stock_movements.product_id = ?", productID)
+			}
+			return query
+		}
+		var rows []valuationRow
+		err := db.Raw("SELECT product_id, warehouse_id, SUM(quantity) AS quantity, SUM(value) AS value FROM (? UNION ALL ?) AS ledger "+
+			"GROUP BY product_id, warehouse_id ORDER BY product_id, warehouse_id",
+			side("to_bin_location_id", ""), side("from_bin_location_id", "-")).
+			Scan(&rows).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var products []models.Product
+		var warehouses []models.Warehouse
+		if err := db.Unscoped().Select("id", "sku", "name").Find(&products).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Unscoped().Select("id", "code").Find(&warehouses).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		productByID := map[uint]models.Product{}
+		for _, product := range products {
+			productByID[product.ID] = product
+		}
+		warehouseCodes := map[uint]string{}
+		for _, warehouse := range warehouses {
+			warehouseCodes[warehouse.ID] = warehouse.Code
+		}
+
+		report := []valuationRow{}
+		var total float64
+		for _, row := range rows {
+			row.Quantity = math.Round(row.Quantity*1e6) / 1e6
+			row.Value = math.Round(row.Value*100) / 100
+			if row.Quantity == 0 && row.Value == 0 {
+				continue
+			}
+			row.SKU = productByID[row.ProductID].SKU
+			row.Name = productByID[row.ProductID].Name
+			row.WarehouseCode = warehouseCodes[row.WarehouseID]
+			if row.Quantity > 0 {
+				row.UnitCost = math.Round(row.Value/row.Quantity*1e6) / 1e6
+			}
+			total += row.Value
+			report = append(report, row)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"as_of":          asOf.Format(time.DateOnly),
+			"costing_method": inventory.CostingMethod(),
+			"total_value":    math.Round(total*100) / 100,
+			"data":           report,
+		})
+	}
+}
+
+// derefID returns the ID a pointer holds, or 0 for nil
+func derefID(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
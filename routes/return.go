@@ -0,0 +1,533 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterReturnRoutes sets up the routes for customer return authorizations
+func RegisterReturnRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	returnCtrl := restful.NewCrudController[models.ReturnAuthorization](db)
+
+	returns := rg.Group("/returns")
+	returns.Use(middleware.AuthMiddleware())
+	{
+		returns.GET("", returnCtrl.Index)
+		returns.GET("/:id", returnCtrl.Show)
+		returns.POST("", storeReturnHandler(db))
+		returns.POST("/:id/receive", receiveReturnHandler(db))
+		returns.POST("/:id/dispose", disposeReturnHandler(db))
+		returns.POST("/:id/close", closeReturnHandler(db))
+		returns.POST("/:id/cancel", cancelReturnHandler(db))
+	}
+}
+
+// storeReturnHandler authorizes the return of shipped sales order lines
+func storeReturnHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			SalesOrderID uint   `json:"sales_order_id" binding:"required"`
+			Reason       string `json:"reason"`
+			Notes        string `json:"notes"`
+			Lines        []struct {
+				SalesOrderLineID uint    `json:"sales_order_line_id" binding:"required"`
+				Quantity         float64 `json:"quantity" binding:"required,gt=0"`
+			} `json:"lines" binding:"required,min=1,dive"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var rma models.ReturnAuthorization
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Locking the order serializes authorizations against the same shipped quantities
+			var so models.SalesOrder
+			if err := lockSalesOrder(tx, fmt.Sprint(input.SalesOrderID), &so); err != nil {
+				return err
+			}
+			if so.Status != models.SalesOrderPartiallyShipped && so.Status != models.SalesOrderShipped && so.Status != models.SalesOrderClosed {
+				return newRequestError(http.StatusConflict, "sales order %s has not been shipped", so.Number)
+			}
+			if err := tx.Where("sales_order_id = ?", so.ID).Find(&so.Lines).Error; err != nil {
+				return err
+			}
+
+			returnable, err := returnableQuantities(tx, &so)
+			if err != nil {
+				return err
+			}
+
+			rma = models.ReturnAuthorization{
+				SalesOrderID: so.ID,
+				CustomerID:   so.CustomerID,
+				WarehouseID:  so.WarehouseID,
+				Status:       models.ReturnOpen,
+				Reason:       input.Reason,
+				Notes:        input.Notes,
+				UserID:       middleware.CurrentUserID(c),
+			}
+			for _, l := range input.Lines {
+				line := findSalesOrderLine(so.Lines, l.SalesOrderLineID)
+				if line == nil {
+					return newRequestError(http.StatusBadRequest, "line %d does not belong to sales order %s", l.SalesOrderLineID, so.Number)
+				}
+				if l.Quantity > returnable[line.ID] {
+					return newRequestError(http.StatusUnprocessableEntity,
+						"line %d only has %g shipped and not yet authorized for return", line.ID, returnable[line.ID])
+				}
+				returnable[line.ID] -= l.Quantity
+				rma.Lines = append(rma.Lines, models.ReturnLine{
+					SalesOrderLineID: line.ID,
+					ProductID:        line.ProductID,
+					Quantity:         l.Quantity,
+				})
+			}
+
+			return tx.Create(&rma).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, rma)
+	}
+}
+
+// receiveReturnHandler receives returned goods into a returns bin, recording
+// their condition. Lots and serials must have been shipped on the sales order.
+// Returned goods are valued at the cost they were shipped at.
+func receiveReturnHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			BinLocationID uint `json:"bin_location_id"`
+			Lines         []struct {
+				ReturnLineID  uint     `json:"return_line_id" binding:"required"`
+				Quantity      float64  `json:"quantity" binding:"required,gt=0"`
+				Condition     string   `json:"condition" binding:"required,oneof=resellable damaged scrap"`
+				LotNumber     string   `json:"lot_number"`
+				SerialNumbers []string `json:"serial_numbers"`
+			} `json:"lines" binding:"required,min=1,dive"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var rma models.ReturnAuthorization
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			if err := lockReturn(tx, c.Param("id"), &rma); err != nil {
+				return err
+			}
+			if rma.Status != models.ReturnOpen {
+				return newRequestError(http.StatusConflict, "cannot receive a return in status %s", rma.Status)
+			}
+			if err := tx.Where("return_authorization_id = ?", rma.ID).Order("id").Find(&rma.Lines).Error; err != nil {
+				return err
+			}
+			binID, err := binOfType(tx, rma.WarehouseID, input.BinLocationID, models.BinTypeReturns)
+			if err != nil {
+				return err
+			}
+
+			for _, l := range input.Lines {
+				line := findReturnLine(rma.Lines, l.ReturnLineID)
+				if line == nil {
+					return newRequestError(http.StatusBadRequest, "line %d does not belong to return %s", l.ReturnLineID, rma.Number)
+				}
+				if line.ReceivedQuantity+l.Quantity > line.Quantity {
+					return newRequestError(http.StatusUnprocessableEntity,
+						"line %d only has %g authorized and not yet received", line.ID, line.Quantity-line.ReceivedQuantity)
+				}
+				if err := checkShippedOnOrder(tx, rma.SalesOrderID, line.ProductID, l.LotNumber, l.Quantity, l.SerialNumbers); err != nil {
+					return err
+				}
+				unitCost, err := shippedUnitCost(tx, rma.SalesOrderID, line.ProductID)
+				if err != nil {
+					return err
+				}
+
+				movement := models.StockMovement{
+					Type:            models.MovementReceive,
+					ProductID:       line.ProductID,
+					ToBinLocationID: &binID,
+					Quantity:        l.Quantity,
+					LotNumber:       l.LotNumber,
+					SerialNumbers:   l.SerialNumbers,
+					UnitCost:        unitCost,
+					Reason:          fmt.Sprintf("Returned on %s (%s)", rma.Number, l.Condition),
+					ReferenceType:   models.ReferenceReturn,
+					ReferenceID:     rma.ID,
+					UserID:          middleware.CurrentUserID(c),
+				}
+				if err := inventory.Post(tx, &movement); err != nil {
+					return fmt.Errorf("line %d: %w", line.ID, err)
+				}
+
+				receipt := models.ReturnReceipt{
+					ReturnLineID:    line.ID,
+					ProductID:       line.ProductID,
+					Quantity:        l.Quantity,
+					Condition:       l.Condition,
+					BinLocationID:   binID,
+					StockMovementID: movement.ID,
+					UserID:          movement.UserID,
+				}
+				if err := tx.Create(&receipt).Error; err != nil {
+					return err
+				}
+				line.ReceivedQuantity += l.Quantity
+				if err := tx.Model(line).Update("received_quantity", line.ReceivedQuantity).Error; err != nil {
+					return err
+				}
+				line.Receipts = append(line.Receipts, receipt)
+			}
+
+			for _, line := range rma.Lines {
+				if line.ReceivedQuantity < line.Quantity {
+					return nil
+				}
+			}
+			rma.Status = models.ReturnReceived
+			return tx.Model(&rma).Update("status", rma.Status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, rma)
+	}
+}
+
+// disposeReturnHandler applies a disposition to received returns: restock
+// moves them into a storage bin, quarantine into a quarantine bin and scrap
+// writes them off. The disposition defaults to the one fitting the recorded
+// condition; only resellable goods can be restocked.
+func disposeReturnHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Receipts []struct {
+				ReturnReceiptID uint   `json:"return_receipt_id" binding:"required"`
+				Disposition     string `json:"disposition" binding:"omitempty,oneof=restock quarantine scrap"`
+				BinLocationID   uint   `json:"bin_location_id"`
+			} `json:"receipts" binding:"required,min=1,dive"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var rma models.ReturnAuthorization
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			if err := lockReturn(tx, c.Param("id"), &rma); err != nil {
+				return err
+			}
+			if rma.Status != models.ReturnOpen && rma.Status != models.ReturnReceived {
+				return newRequestError(http.StatusConflict, "cannot dispose of a return in status %s", rma.Status)
+			}
+
+			now := time.Now()
+			for _, r := range input.Receipts {
+				var receipt models.ReturnReceipt
+				err := inventory.ForUpdate(tx).Preload("StockMovement.Serials").
+					Where("return_line_id IN (?)", tx.Model(&models.ReturnLine{}).Select("id").Where("return_authorization_id = ?", rma.ID)).
+					First(&receipt, r.ReturnReceiptID).Error
+				if err != nil {
+					return newRequestError(http.StatusBadRequest, "receipt %d does not belong to return %s", r.ReturnReceiptID, rma.Number)
+				}
+				if receipt.Disposition != "" {
+					return newRequestError(http.StatusConflict, "receipt %d has already been disposed of (%s)", receipt.ID, receipt.Disposition)
+				}
+
+				disposition := r.Disposition
+				if disposition == "" {
+					disposition = models.DefaultDisposition(receipt.Condition)
+				}
+				movement := models.StockMovement{
+					ProductID:         receipt.ProductID,
+					FromBinLocationID: &receipt.BinLocationID,
+					LotID:             receipt.StockMovement.LotID,
+					Quantity:          receipt.Quantity,
+					Reason:            fmt.Sprintf("Return %s: %s", rma.Number, disposition),
+					ReferenceType:     models.ReferenceReturn,
+					ReferenceID:       rma.ID,
+					UserID:            middleware.CurrentUserID(c),
+				}
+				for _, serial := range receipt.StockMovement.Serials {
+					movement.SerialNumbers = append(movement.SerialNumbers, serial.Number)
+				}
+
+				switch disposition {
+				case models.DispositionRestock:
+					if receipt.Condition != models.ConditionResellable {
+						return newRequestError(http.StatusUnprocessableEntity, "receipt %d is %s and cannot be restocked", receipt.ID, receipt.Condition)
+					}
+					if r.BinLocationID == 0 {
+						return newRequestError(http.StatusBadRequest, "receipt %d: a storage bin location is required to restock", receipt.ID)
+					}
+					binID, err := binOfType(tx, rma.WarehouseID, r.BinLocationID, models.BinTypeStorage)
+					if err != nil {
+						return err
+					}
+					movement.Type = models.MovementTransfer
+					movement.ToBinLocationID = &binID
+				case models.DispositionQuarantine:
+					binID, err := binOfType(tx, rma.WarehouseID, r.BinLocationID, models.BinTypeQuarantine)
+					if err != nil {
+						return err
+					}
+					movement.Type = models.MovementTransfer
+					movement.ToBinLocationID = &binID
+				default:
+					movement.Type = models.MovementAdjust
+				}
+				if err := inventory.Post(tx, &movement); err != nil {
+					return fmt.Errorf("receipt %d: %w", receipt.ID, err)
+				}
+
+				receipt.Disposition = disposition
+				receipt.DispositionBinLocationID = movement.ToBinLocationID
+				receipt.DisposedAt = &now
+				if err := tx.Model(&receipt).Select("disposition", "disposition_bin_location_id", "disposed_at").Updates(&receipt).Error; err != nil {
+					return err
+				}
+			}
+
+			if rma.Status != models.ReturnReceived {
+				return nil
+			}
+			pending, err := pendingReceipts(tx, rma.ID)
+			if err != nil || pending > 0 {
+				return err
+			}
+			rma.Status = models.ReturnClosed
+			return tx.Model(&rma).Update("status", rma.Status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		if err := db.Preload("Lines.Receipts").First(&rma, rma.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rma)
+	}
+}
+
+// closeReturnHandler closes a return that will not receive any more goods.
+// Every received receipt must have been disposed of first.
+func closeReturnHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rma models.ReturnAuthorization
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockReturn(tx, c.Param("id"), &rma); err != nil {
+				return err
+			}
+			if rma.Status != models.ReturnOpen && rma.Status != models.ReturnReceived {
+				return newRequestError(http.StatusConflict, "cannot close a return in status %s", rma.Status)
+			}
+			pending, err := pendingReceipts(tx, rma.ID)
+			if err != nil {
+				return err
+			}
+			if pending > 0 {
+				return newRequestError(http.StatusConflict, "return %s has %d receipts without a disposition", rma.Number, pending)
+			}
+			rma.Status = models.ReturnClosed
+			return tx.Model(&rma).Update("status", rma.Status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, rma)
+	}
+}
+
+// cancelReturnHandler cancels an open return that has not received anything
+func cancelReturnHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rma models.ReturnAuthorization
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockReturn(tx, c.Param("id"), &rma); err != nil {
+				return err
+			}
+			if rma.Status != models.ReturnOpen {
+				return newRequestError(http.StatusConflict, "cannot cancel a return in status %s", rma.Status)
+			}
+			var received int64
+			if err := tx.Model(&models.ReturnLine{}).Where("return_authorization_id = ? AND received_quantity > 0", rma.ID).Count(&received).Error; err != nil {
+				return err
+			}
+			if received > 0 {
+				return newRequestError(http.StatusConflict, "return %s has already received goods, close it instead", rma.Number)
+			}
+			rma.Status = models.ReturnCancelled
+			return tx.Model(&rma).Update("status", rma.Status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, rma)
+	}
+}
+
+// returnableQuantities returns, per sales order line, the shipped quantity
+// not yet authorized for return. Closed returns only count what they received;
+// cancelled returns do not count at all.
+func returnableQuantities(tx *gorm.DB, so *models.SalesOrder) (map[uint]float64, error) {
+	returnable := map[uint]float64{}
+	for _, line := range so.Lines {
+		returnable[line.ID] = line.ShippedQuantity
+	}
+
+	var authorized []struct {
+		SalesOrderLineID uint
+		Quantity         float64
+	}
+	err := tx.Table("return_lines").
+		Select("return_lines.sales_order_line_id, SUM(CASE WHEN return_authorizations.status = ? "+
+			"THEN return_lines.received_quantity ELSE return_lines.quantity END) AS quantity", models.ReturnClosed).
+		Joins("JOIN return_authorizations ON return_authorizations.id = return_lines.return_authorization_id").
+		Where("return_authorizations.sales_order_id = ? AND return_authorizations.status <> ?", so.ID, models.ReturnCancelled).
+		Where("return_lines.deleted_at IS NULL").
+		Group("return_lines.sales_order_line_id").
+		Scan(&authorized).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range authorized {
+		returnable[a.SalesOrderLineID] -= a.Quantity
+	}
+	return returnable, nil
+}
+
+// checkShippedOnOrder verifies that a returned lot or the returned serials
+// left the warehouse on the given sales order, and that no more of a lot
+// comes back than was shipped from it
+func checkShippedOnOrder(tx *gorm.DB, salesOrderID, productID uint, lotNumber string, quantity float64, serialNumbers []string) error {
+	shipped := func() *gorm.DB {
+		return tx.Model(&models.StockMovement{}).
+			Where("stock_movements.type = ? AND stock_movements.reference_type = ? AND stock_movements.reference_id = ? AND stock_movements.product_id = ?",
+				models.MovementIssue, models.ReferenceSalesOrder, salesOrderID, productID)
+	}
+
+	if lotNumber != "" {
+		var lot struct {
+			Count    int64
+			Quantity float64
+		}
+		err := shipped().Joins("JOIN lots ON lots.id = stock_movements.lot_id").
+			Where("lots.number = ?", lotNumber).
+			Select("COUNT(*) AS count, COALESCE(SUM(stock_movements.quantity), 0) AS quantity").
+			Scan(&lot).Error
+		if err != nil {
+			return err
+		}
+		if lot.Count == 0 {
+			return newRequestError(http.StatusUnprocessableEntity, "lot %s of product %d was not shipped on this sales order", lotNumber, productID)
+		}
+
+		// Receipts of earlier lines in the same request are already posted
+		var returned float64
+		err = tx.Model(&models.StockMovement{}).
+			Joins("JOIN lots ON lots.id = stock_movements.lot_id").
+			Where("stock_movements.type = ? AND stock_movements.reference_type = ? AND stock_movements.product_id = ? AND lots.number = ?",
+				models.MovementReceive, models.ReferenceReturn, productID, lotNumber).
+			Where("stock_movements.reference_id IN (?)", tx.Model(&models.ReturnAuthorization{}).Select("id").Where("sales_order_id = ?", salesOrderID)).
+			Select("COALESCE(SUM(stock_movements.quantity), 0)").
+			Scan(&returned).Error
+		if err != nil {
+			return err
+		}
+		if returned+quantity > lot.Quantity {
+			return newRequestError(http.StatusUnprocessableEntity,
+				"only %g of lot %s of product %d was shipped on this sales order and %g has already been returned", lot.Quantity, lotNumber, productID, returned)
+		}
+	}
+
+	if len(serialNumbers) > 0 {
+		var found []string
+		err := shipped().Joins("JOIN stock_movement_serials ON stock_movement_serials.stock_movement_id = stock_movements.id").
+			Joins("JOIN serial_numbers ON serial_numbers.id = stock_movement_serials.serial_number_id").
+			Where("serial_numbers.number IN ?", serialNumbers).
+			Distinct().Pluck("serial_numbers.number", &found).Error
+		if err != nil {
+			return err
+		}
+		shippedSerials := map[string]bool{}
+		for _, number := range found {
+			shippedSerials[number] = true
+		}
+		for _, number := range serialNumbers {
+			if !shippedSerials[number] {
+				return newRequestError(http.StatusUnprocessableEntity, "serial %s of product %d was not shipped on this sales order", number, productID)
+			}
+		}
+	}
+	return nil
+}
+
+// shippedUnitCost returns the average cost per unit a product was issued at
+// on a sales order, or 0 when it is unknown
+func shippedUnitCost(tx *gorm.DB, salesOrderID, productID uint) (float64, error) {
+	var shipped struct {
+		Quantity float64
+		Cost     float64
+	}
+	err := tx.Model(&models.StockMovement{}).
+		Select("COALESCE(SUM(quantity), 0) AS quantity, COALESCE(SUM(cost_amount), 0) AS cost").
+		Where("type = ? AND reference_type = ? AND reference_id = ? AND product_id = ?",
+			models.MovementIssue, models.ReferenceSalesOrder, salesOrderID, productID).
+		Scan(&shipped).Error
+	if err != nil || shipped.Quantity <= 0 {
+		return 0, err
+	}
+	return shipped.Cost / shipped.Quantity, nil
+}
+
+// pendingReceipts counts the receipts of a return that have no disposition yet
+func pendingReceipts(tx *gorm.DB, returnID uint) (int64, error) {
+	var pending int64
+	err := tx.Model(&models.ReturnReceipt{}).
+		Where("return_line_id IN (?)", tx.Model(&models.ReturnLine{}).Select("id").Where("return_authorization_id = ?", returnID)).
+		Where("disposition = ? OR disposition IS NULL", "").
+		Count(&pending).Error
+	return pending, err
+}
+
+// findReturnLine returns the line with the given ID, or nil
+func findReturnLine(lines []models.ReturnLine, id uint) *models.ReturnLine {
+	for i := range lines {
+		if lines[i].ID == id {
+			return &lines[i]
+		}
+	}
+	return nil
+}
+
+// lockReturn loads a return authorization for update
+func lockReturn(tx *gorm.DB, id string, rma *models.ReturnAuthorization) error {
+	if err := inventory.ForUpdate(tx).First(rma, "id = ?", id).Error; err != nil {
+		return newRequestError(http.StatusNotFound, "Return authorization not found")
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterSalesOrderRoutes sets up the routes for customers and sales orders
+func RegisterSalesOrderRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	customerCtrl := restful.NewCrudController[models.Customer](db)
+	soCtrl := restful.NewCrudController[models.SalesOrder](db)
+
+	customers := rg.Group("/customers")
+	customers.Use(middleware.AuthMiddleware())
+	{
+		customers.GET("", customerCtrl.Index)
+		customers.GET("/:id", customerCtrl.Show)
+		customers.POST("", customerCtrl.Store)
+		customers.PUT("/:id", customerCtrl.Update)
+		customers.DELETE("/:id", customerCtrl.Destroy)
+	}
+
+	orders := rg.Group("/sales-orders")
+	orders.Use(middleware.AuthMiddleware())
+	{
+		orders.GET("", soCtrl.Index)
+		orders.GET("/:id", soCtrl.Show)
+		orders.POST("", storeSalesOrderHandler(db))
+		orders.PUT("/:id", updateSalesOrderHandler(db))
+		orders.DELETE("/:id", destroySalesOrderHandler(db))
+
+		// Lifecycle transitions
+		orders.POST("/:id/confirm", confirmSalesOrderHandler(db))
+		orders.POST("/:id/cancel", releaseSalesOrderHandler(db, models.SalesOrderCancelled))
+		orders.POST("/:id/close", releaseSalesOrderHandler(db, models.SalesOrderClosed))
+	}
+}
+
+// salesOrderInput is the request body for creating or updating a draft sales order
+type salesOrderInput struct {
+	CustomerID  uint   `json:"customer_id" binding:"required"`
+	WarehouseID uint   `json:"warehouse_id" binding:"required"`
+	Notes       string `json:"notes"`
+	Lines       []struct {
+		ProductID       uint    `json:"product_id" binding:"required"`
+		Quantity        float64 `json:"quantity" binding:"required,gt=0"`
+		UnitOfMeasureID uint    `json:"unit_of_measure_id"`
+	} `json:"lines" binding:"required,min=1,dive"`
+}
+
+// validate checks that the customer, warehouse and products referenced by the input exist
+func (input *salesOrderInput) validate(tx *gorm.DB) error {
+	var count int64
+	if tx.Model(&models.Customer{}).Where("id = ?", input.CustomerID).Count(&count); count == 0 {
+		return newRequestError(http.StatusBadRequest, "customer %d not found", input.CustomerID)
+	}
+	if tx.Model(&models.Warehouse{}).Where("id = ?", input.WarehouseID).Count(&count); count == 0 {
+		return newRequestError(http.StatusBadRequest, "warehouse %d not found", input.WarehouseID)
+	}
+	for _, line := range input.Lines {
+		if tx.Model(&models.Product{}).Where("id = ?", line.ProductID).Count(&count); count == 0 {
+			return newRequestError(http.StatusBadRequest, "product %d not found", line.ProductID)
+		}
+	}
+	return nil
+}
+
+// lines converts the input lines into sales order lines, normalizing the
+// sold quantity to the product's base unit
+func (input *salesOrderInput) lines(tx *gorm.DB) ([]models.SalesOrderLine, error) {
+	lines := make([]models.SalesOrderLine, 0, len(input.Lines))
+	for _, line := range input.Lines {
+		quantity, err := models.ToBaseQuantity(tx, line.ProductID, line.UnitOfMeasureID, line.Quantity)
+		if err != nil {
+			return nil, newRequestError(http.StatusBadRequest, "%s", err.Error())
+		}
+		lines = append(lines, models.SalesOrderLine{
+			ProductID:       line.ProductID,
+			Quantity:        quantity,
+			UnitOfMeasureID: optionalID(line.UnitOfMeasureID),
+			UnitQuantity:    line.Quantity,
+		})
+	}
+	return lines, nil
+}
+
+// storeSalesOrderHandler creates a sales order in draft status
+func storeSalesOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input salesOrderInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		so := models.SalesOrder{
+			CustomerID:  input.CustomerID,
+			WarehouseID: input.WarehouseID,
+			Status:      models.SalesOrderDraft,
+			Notes:       input.Notes,
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := input.validate(tx); err != nil {
+				return err
+			}
+			lines, err := input.lines(tx)
+			if err != nil {
+				return err
+			}
+			so.Lines = lines
+			return tx.Create(&so).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, so)
+	}
+}
+
+// updateSalesOrderHandler replaces the header and lines of a draft sales order
+func updateSalesOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input salesOrderInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var so models.SalesOrder
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockSalesOrder(tx, c.Param("id"), &so); err != nil {
+				return err
+			}
+			if so.Status != models.SalesOrderDraft {
+				return newRequestError(http.StatusConflict, "only draft sales orders can be edited")
+			}
+			if err := input.validate(tx); err != nil {
+				return err
+			}
+			lines, err := input.lines(tx)
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Where("sales_order_id = ?", so.ID).Delete(&models.SalesOrderLine{}).Error; err != nil {
+				return err
+			}
+
+			so.CustomerID = input.CustomerID
+			so.WarehouseID = input.WarehouseID
+			so.Notes = input.Notes
+			so.Lines = lines
+			return tx.Save(&so).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, so)
+	}
+}
+
+// destroySalesOrderHandler deletes a draft sales order and its lines
+func destroySalesOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var so models.SalesOrder
+			if err := lockSalesOrder(tx, c.Param("id"), &so); err != nil {
+				return err
+			}
+			if so.Status != models.SalesOrderDraft {
+				return newRequestError(http.StatusConflict, "only draft sales orders can be deleted, cancel it instead")
+			}
+			if err := tx.Where("sales_order_id = ?", so.ID).Delete(&models.SalesOrderLine{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&so).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Success"})
+	}
+}
+
+// confirmSalesOrderHandler confirms a draft sales order and reserves stock for every line.
+// The order is only confirmed when all lines can be fully reserved.
+func confirmSalesOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var so models.SalesOrder
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			if err := lockSalesOrder(tx, c.Param("id"), &so); err != nil {
+				return err
+			}
+			if !so.CanTransitionTo(models.SalesOrderConfirmed) {
+				return newRequestError(http.StatusConflict, "cannot move sales order from %s to %s", so.Status, models.SalesOrderConfirmed)
+			}
+			if err := tx.Where("sales_order_id = ?", so.ID).Order("id").Find(&so.Lines).Error; err != nil {
+				return err
+			}
+
+			for i := range so.Lines {
+				line := &so.Lines[i]
+				err := inventory.Reserve(tx, line, so.WarehouseID, line.Quantity-line.ReservedQuantity)
+				if errors.Is(err, inventory.ErrInsufficientStock) {
+					return newRequestError(http.StatusConflict, "insufficient stock to reserve line %d (product %d)", line.ID, line.ProductID)
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			so.Status = models.SalesOrderConfirmed
+			return tx.Model(&so).Update("status", so.Status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, so)
+	}
+}
+
+// releaseSalesOrderHandler ends a sales order and releases its reservations:
+// cancelled for draft and confirmed orders, closed for partially shipped
+// orders whose remainder will not ship
+func releaseSalesOrderHandler(db *gorm.DB, status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var so models.SalesOrder
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			if err := lockSalesOrder(tx, c.Param("id"), &so); err != nil {
+				return err
+			}
+			if !so.CanTransitionTo(status) {
+				return newRequestError(http.StatusConflict, "cannot move sales order from %s to %s", so.Status, status)
+			}
+			if err := tx.Where("sales_order_id = ?", so.ID).Order("id").Find(&so.Lines).Error; err != nil {
+				return err
+			}
+
+			for i := range so.Lines {
+				if err := inventory.Release(tx, &so.Lines[i]); err != nil {
+					return err
+				}
+			}
+
+			so.Status = status
+			return tx.Model(&so).Update("status", so.Status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, so)
+	}
+}
+
+// lockSalesOrder loads a sales order and locks its row for the rest of the transaction
+func lockSalesOrder(tx *gorm.DB, id string, so *models.SalesOrder) error {
+	if err := inventory.ForUpdate(tx).First(so, "id = ?", id).Error; err != nil {
+		return newRequestError(http.StatusNotFound, "Sales order not found")
+	}
+	return nil
+}
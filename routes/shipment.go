@@ -0,0 +1,426 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/carrier"
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterShipmentRoutes sets up the routes for shipments and their packages
+func RegisterShipmentRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	shipmentCtrl := restful.NewCrudController[models.Shipment](db)
+
+	shipments := rg.Group("/shipments")
+	shipments.Use(middleware.AuthMiddleware())
+	{
+		shipments.GET("", shipmentCtrl.Index)
+		shipments.GET("/:id", shipmentCtrl.Show)
+		shipments.POST("", storeShipmentHandler(db))
+		shipments.POST("/:id/ship", shipShipmentHandler(db))
+		shipments.POST("/:id/cancel", cancelShipmentHandler(db))
+	}
+
+	rg.GET("/carriers", middleware.AuthMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": carrier.Names()})
+	})
+}
+
+// storeShipmentHandler packs picked sales order lines into the packages of a new shipment
+func storeShipmentHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			SalesOrderID uint   `json:"sales_order_id" binding:"required"`
+			Carrier      string `json:"carrier" binding:"required"`
+			Service      string `json:"service"`
+			Packages     []struct {
+				Weight float64 `json:"weight" binding:"gte=0"`
+				Length float64 `json:"length" binding:"gte=0"`
+				Width  float64 `json:"width" binding:"gte=0"`
+				Height float64 `json:"height" binding:"gte=0"`
+				Lines  []struct {
+					SalesOrderLineID uint    `json:"sales_order_line_id" binding:"required"`
+					Quantity         float64 `json:"quantity" binding:"required,gt=0"`
+				} `json:"lines" binding:"required,min=1,dive"`
+			} `json:"packages" binding:"required,min=1,dive"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := carrier.Get(input.Carrier); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var shipment models.Shipment
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var so models.SalesOrder
+			if err := lockSalesOrder(tx, fmt.Sprint(input.SalesOrderID), &so); err != nil {
+				return err
+			}
+			if so.Status != models.SalesOrderConfirmed && so.Status != models.SalesOrderPartiallyShipped {
+				return newRequestError(http.StatusConflict, "cannot ship a sales order in status %s", so.Status)
+			}
+			if err := tx.Where("sales_order_id = ?", so.ID).Find(&so.Lines).Error; err != nil {
+				return err
+			}
+
+			packable, err := packableQuantities(tx, &so)
+			if err != nil {
+				return err
+			}
+
+			shipment = models.Shipment{
+				SalesOrderID: so.ID,
+				Status:       models.ShipmentOpen,
+				Carrier:      input.Carrier,
+				Service:      input.Service,
+				UserID:       middleware.CurrentUserID(c),
+			}
+			for _, p := range input.Packages {
+				pkg := models.Package{Weight: p.Weight, Length: p.Length, Width: p.Width, Height: p.Height}
+				for _, l := range p.Lines {
+					line := findSalesOrderLine(so.Lines, l.SalesOrderLineID)
+					if line == nil {
+						return newRequestError(http.StatusBadRequest, "line %d does not belong to sales order %s", l.SalesOrderLineID, so.Number)
+					}
+					if l.Quantity > packable[line.ID] {
+						return newRequestError(http.StatusUnprocessableEntity,
+							"line %d only has %g picked and not yet packed", line.ID, packable[line.ID])
+					}
+					packable[line.ID] -= l.Quantity
+					pkg.Lines = append(pkg.Lines, models.PackageLine{
+						SalesOrderLineID: line.ID,
+						ProductID:        line.ProductID,
+						Quantity:         l.Quantity,
+					})
+				}
+				shipment.Packages = append(shipment.Packages, pkg)
+			}
+
+			return tx.Create(&shipment).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, shipment)
+	}
+}
+
+// shipShipmentHandler books the shipment with its carrier, issues the packed
+// stock out of staging and marks the sales order lines shipped. The optional
+// body {"override_expiry": true} ships lots that expired after they were picked.
+//
+// The carrier is called outside any transaction: the shipment is first
+// checked and set to booking, then booked, and the label and stock are
+// recorded afterwards. A shipment whose label was booked but not recorded
+// stays booking and is shipped again without a new booking.
+func shipShipmentHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			OverrideExpiry bool `json:"override_expiry"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.OverrideExpiry && !middleware.HasPermission(c, middleware.PermissionIssueExpired) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to issue expired stock"})
+			return
+		}
+
+		var shipment models.Shipment
+		var cr carrier.Carrier
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			if err := inventory.ForUpdate(tx).Preload("Packages.Lines").First(&shipment, "id = ?", c.Param("id")).Error; err != nil {
+				return newRequestError(http.StatusNotFound, "Shipment not found")
+			}
+			booked := shipment.Status == models.ShipmentBooking && shipment.TrackingNumber != ""
+			if shipment.Status != models.ShipmentOpen && !booked {
+				return newRequestError(http.StatusConflict, "cannot ship a shipment in status %s", shipment.Status)
+			}
+			var err error
+			if cr, err = carrier.Get(shipment.Carrier); err != nil {
+				return newRequestError(http.StatusBadRequest, "%s", err.Error())
+			}
+			if booked {
+				return nil
+			}
+
+			// Issue the stock and roll it back, so the label is only booked
+			// for a shipment whose stock can leave
+			err = tx.Transaction(func(tx *gorm.DB) error {
+				if err := issueShipment(c, tx, &shipment, input.OverrideExpiry); err != nil {
+					return err
+				}
+				return errDryRun
+			})
+			if !errors.Is(err, errDryRun) {
+				return err
+			}
+			shipment.Status = models.ShipmentBooking
+			return tx.Model(&shipment).Update("status", shipment.Status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		if shipment.TrackingNumber == "" {
+			req := carrier.Request{Reference: shipment.Number, Service: shipment.Service}
+			for _, pkg := range shipment.Packages {
+				req.Parcels = append(req.Parcels, carrier.Parcel{Weight: pkg.Weight, Length: pkg.Length, Width: pkg.Width, Height: pkg.Height})
+			}
+			result, err := cr.Ship(c.Request.Context(), req)
+			if err != nil {
+				db.Model(&shipment).Where("status = ?", models.ShipmentBooking).Update("status", models.ShipmentOpen)
+				respondError(c, newRequestError(http.StatusBadGateway, "carrier %s: %s", shipment.Carrier, err.Error()))
+				return
+			}
+
+			// The label exists now; record it before anything else can fail
+			err = db.Transaction(func(tx *gorm.DB) error {
+				for i := range shipment.Packages {
+					if i < len(result.ParcelTrackingNumbers) {
+						shipment.Packages[i].TrackingNumber = result.ParcelTrackingNumbers[i]
+						if err := tx.Model(&shipment.Packages[i]).Update("tracking_number", shipment.Packages[i].TrackingNumber).Error; err != nil {
+							return err
+						}
+					}
+				}
+				shipment.TrackingNumber = result.TrackingNumber
+				return tx.Model(&shipment).Update("tracking_number", shipment.TrackingNumber).Error
+			})
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+		}
+
+		err = inventory.Transaction(db, func(tx *gorm.DB) error {
+			var current models.Shipment
+			if err := inventory.ForUpdate(tx).Select("id", "status").First(&current, shipment.ID).Error; err != nil {
+				return err
+			}
+			if current.Status != models.ShipmentBooking {
+				return newRequestError(http.StatusConflict, "cannot ship a shipment in status %s", current.Status)
+			}
+			if err := issueShipment(c, tx, &shipment, input.OverrideExpiry); err != nil {
+				return err
+			}
+
+			now := time.Now()
+			shipment.Status = models.ShipmentShipped
+			shipment.ShippedAt = &now
+			return tx.Model(&shipment).Updates(map[string]interface{}{
+				"status":     shipment.Status,
+				"shipped_at": shipment.ShippedAt,
+			}).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, shipment)
+	}
+}
+
+// errDryRun rolls back a savepoint whose changes were only made to check them
+var errDryRun = errors.New("dry run")
+
+// issueShipment issues the packed stock of a shipment out of staging and
+// marks its sales order lines, and the order, shipped
+func issueShipment(c *gin.Context, tx *gorm.DB, shipment *models.Shipment, overrideExpiry bool) error {
+	var so models.SalesOrder
+	if err := lockSalesOrder(tx, fmt.Sprint(shipment.SalesOrderID), &so); err != nil {
+		return err
+	}
+	if err := tx.Where("sales_order_id = ?", so.ID).Order("id").Find(&so.Lines).Error; err != nil {
+		return err
+	}
+
+	for _, pkg := range shipment.Packages {
+		for _, packed := range pkg.Lines {
+			line := findSalesOrderLine(so.Lines, packed.SalesOrderLineID)
+			movement := models.StockMovement{
+				Type:          models.MovementIssue,
+				ProductID:     packed.ProductID,
+				Reason:        fmt.Sprintf("Shipped on %s", shipment.Number),
+				ReferenceType: models.ReferenceSalesOrder,
+				ReferenceID:   so.ID,
+				UserID:        middleware.CurrentUserID(c),
+				AllowExpired:  overrideExpiry,
+			}
+			if err := issueFromStaging(tx, line, packed.Quantity, movement); err != nil {
+				return err
+			}
+			line.ShippedQuantity += packed.Quantity
+			if err := tx.Model(line).Update("shipped_quantity", line.ShippedQuantity).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	status := models.SalesOrderShipped
+	for _, line := range so.Lines {
+		if line.ShippedQuantity < line.Quantity {
+			status = models.SalesOrderPartiallyShipped
+			break
+		}
+	}
+	if status == so.Status {
+		return nil
+	}
+	return tx.Model(&so).Update("status", status).Error
+}
+
+// cancelShipmentHandler cancels an open shipment, leaving the packed goods in staging
+func cancelShipmentHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var shipment models.Shipment
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := inventory.ForUpdate(tx).First(&shipment, "id = ?", c.Param("id")).Error; err != nil {
+				return newRequestError(http.StatusNotFound, "Shipment not found")
+			}
+			if shipment.Status != models.ShipmentOpen {
+				return newRequestError(http.StatusConflict, "cannot cancel a shipment in status %s", shipment.Status)
+			}
+			shipment.Status = models.ShipmentCancelled
+			return tx.Model(&shipment).Update("status", shipment.Status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, shipment)
+	}
+}
+
+// packableQuantities returns, per sales order line, the picked quantity that
+// is neither shipped nor packed into another open or booking shipment
+func packableQuantities(tx *gorm.DB, so *models.SalesOrder) (map[uint]float64, error) {
+	packable := map[uint]float64{}
+	for _, line := range so.Lines {
+		packable[line.ID] = line.PickedQuantity - line.ShippedQuantity
+	}
+
+	var packed []struct {
+		SalesOrderLineID uint
+		Quantity         float64
+	}
+	err := tx.Table("package_lines").
+		Select("package_lines.sales_order_line_id, SUM(package_lines.quantity) AS quantity").
+		Joins("JOIN packages ON packages.id = package_lines.package_id").
+		Joins("JOIN shipments ON shipments.id = packages.shipment_id").
+		Where("shipments.sales_order_id = ? AND shipments.status IN ?", so.ID, []string{models.ShipmentOpen, models.ShipmentBooking}).
+		Where("package_lines.deleted_at IS NULL").
+		Group("package_lines.sales_order_line_id").
+		Scan(&packed).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packed {
+		packable[p.SalesOrderLineID] -= p.Quantity
+	}
+	return packable, nil
+}
+
+// issueFromStaging consumes qty of a line's reservations held in staging bins
+// and issues that stock out of the warehouse
+func issueFromStaging(tx *gorm.DB, line *models.SalesOrderLine, qty float64, movement models.StockMovement) error {
+	var reservations []models.StockReservation
+	err := inventory.ForUpdate(tx).Preload("StockLevel").
+		Where("sales_order_line_id = ?", line.ID).
+		Where("stock_level_id IN (?)", tx.Model(&models.StockLevel{}).Select("stock_levels.id").
+			Joins("JOIN bin_locations ON bin_locations.id = stock_levels.bin_location_id").
+			Where("bin_locations.type = ?", models.BinTypeStaging)).
+		Order("id").
+		Find(&reservations).Error
+	if err != nil {
+		return err
+	}
+
+	remaining := qty
+	for i := range reservations {
+		if remaining <= 0 {
+			break
+		}
+		reservation := &reservations[i]
+		take := reservation.Quantity
+		if take > remaining {
+			take = remaining
+		}
+
+		if err := inventory.Unreserve(tx, reservation, take); err != nil {
+			return err
+		}
+		m := movement
+		m.FromBinLocationID = &reservation.StockLevel.BinLocationID
+		m.Quantity = take
+		if reservation.StockLevel.LotID != 0 {
+			m.LotID = &reservation.StockLevel.LotID
+		}
+		if m.SerialNumbers, err = stagedSerials(tx, line, reservation.StockLevel.BinLocationID, take); err != nil {
+			return err
+		}
+		if err := inventory.Post(tx, &m); err != nil {
+			return err
+		}
+		remaining -= take
+	}
+
+	if remaining > 0 {
+		return newRequestError(http.StatusConflict, "line %d has only %g staged for shipping", line.ID, qty-remaining)
+	}
+	return nil
+}
+
+// stagedSerials returns n of the serial numbers picked for a line that are
+// still in the given staging bin, or nil when the line was picked without serials
+func stagedSerials(tx *gorm.DB, line *models.SalesOrderLine, binID uint, n float64) ([]string, error) {
+	var pickLines []models.PickListLine
+	if err := tx.Where("sales_order_line_id = ?", line.ID).Order("id").Find(&pickLines).Error; err != nil {
+		return nil, err
+	}
+	var picked []string
+	for _, pickLine := range pickLines {
+		picked = append(picked, pickLine.SerialNumbers...)
+	}
+	if len(picked) == 0 {
+		return nil, nil
+	}
+
+	var serials []string
+	err := tx.Model(&models.SerialNumber{}).
+		Where("product_id = ? AND bin_location_id = ? AND status = ? AND number IN ?", line.ProductID, binID, models.SerialInStock, picked).
+		Order("id").
+		Limit(int(n)).
+		Pluck("number", &serials).Error
+	return serials, err
+}
+
+// findSalesOrderLine returns the line with the given ID, or nil
+func findSalesOrderLine(lines []models.SalesOrderLine, id uint) *models.SalesOrderLine {
+	for i := range lines {
+		if lines[i].ID == id {
+			return &lines[i]
+		}
+	}
+	return nil
+}
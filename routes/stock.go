@@ -0,0 +1,298 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterStockRoutes sets up the routes for stock levels and stock movements.
+// Stock levels, lots and serial numbers are read-only: they only change by posting movements.
+func RegisterStockRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	levelCtrl := restful.NewCrudController[models.StockLevel](db)
+	movementCtrl := restful.NewCrudController[models.StockMovement](db)
+	lotCtrl := restful.NewCrudController[models.Lot](db)
+	serialCtrl := restful.NewCrudController[models.SerialNumber](db)
+
+	levels := rg.Group("/stock-levels")
+	levels.Use(middleware.AuthMiddleware(), blindCountMiddleware(db))
+	{
+		levels.GET("", levelCtrl.Index)
+		levels.GET("/:id", levelCtrl.Show)
+	}
+
+	movements := rg.Group("/stock-movements")
+	movements.Use(middleware.AuthMiddleware())
+	{
+		movements.GET("", movementCtrl.Index)
+		movements.GET("/:id", movementCtrl.Show)
+	}
+
+	lots := rg.Group("/lots")
+	lots.Use(middleware.AuthMiddleware())
+	{
+		lots.GET("", lotCtrl.Index)
+		lots.GET("/:id", lotCtrl.Show)
+	}
+
+	serials := rg.Group("/serial-numbers")
+	serials.Use(middleware.AuthMiddleware())
+	{
+		serials.GET("", serialCtrl.Index)
+		serials.GET("/:id", serialCtrl.Show)
+	}
+
+	stock := rg.Group("/stock")
+	stock.Use(middleware.AuthMiddleware())
+	{
+		stock.POST("/receive", movementHandler(db, models.MovementReceive))
+		stock.POST("/issue", movementHandler(db, models.MovementIssue))
+		stock.POST("/transfer", movementHandler(db, models.MovementTransfer))
+		stock.POST("/adjust", movementHandler(db, models.MovementAdjust))
+		stock.GET("/expiring", expiringStockHandler(db))
+	}
+}
+
+// movementHandler posts a single stock movement of the given type.
+// Receive and issue use bin_location_id, transfer uses from/to_bin_location_id
+// and adjust takes a signed quantity against bin_location_id. Lot and serial
+// tracked products also need lot_number or serial_numbers. Quantities in
+// another unit than the product's base unit are converted first, and so is
+// the unit_cost of incoming stock. Issuing from an expired lot needs
+// override_expiry and the matching permission.
+func movementHandler(db *gorm.DB, movementType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			ProductID         uint       `json:"product_id" binding:"required"`
+			BinLocationID     uint       `json:"bin_location_id"`
+			FromBinLocationID uint       `json:"from_bin_location_id"`
+			ToBinLocationID   uint       `json:"to_bin_location_id"`
+			Quantity          float64    `json:"quantity" binding:"required"`
+			UnitOfMeasureID   uint       `json:"unit_of_measure_id"`
+			UnitCost          float64    `json:"unit_cost" binding:"gte=0"`
+			LotNumber         string     `json:"lot_number"`
+			ExpiresAt         *time.Time `json:"expires_at"`
+			SerialNumbers     []string   `json:"serial_numbers"`
+			Reason            string     `json:"reason"`
+			OverrideExpiry    bool       `json:"override_expiry"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.OverrideExpiry && !middleware.HasPermission(c, middleware.PermissionIssueExpired) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to issue expired stock"})
+			return
+		}
+
+		movement := models.StockMovement{
+			Type:          movementType,
+			ProductID:     input.ProductID,
+			Quantity:      input.Quantity,
+			LotNumber:     input.LotNumber,
+			ExpiresAt:     input.ExpiresAt,
+			SerialNumbers: input.SerialNumbers,
+			Reason:        input.Reason,
+			UserID:        middleware.CurrentUserID(c),
+			AllowExpired:  input.OverrideExpiry,
+		}
+
+		switch movementType {
+		case models.MovementReceive:
+			movement.ToBinLocationID = optionalID(input.BinLocationID)
+		case models.MovementIssue:
+			movement.FromBinLocationID = optionalID(input.BinLocationID)
+		case models.MovementTransfer:
+			movement.FromBinLocationID = optionalID(input.FromBinLocationID)
+			movement.ToBinLocationID = optionalID(input.ToBinLocationID)
+		case models.MovementAdjust:
+			if input.Reason == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required for adjustments"})
+				return
+			}
+			// A positive quantity adds stock to the bin, a negative one removes it
+			if input.Quantity < 0 {
+				movement.Quantity = -input.Quantity
+				movement.FromBinLocationID = optionalID(input.BinLocationID)
+			} else {
+				movement.ToBinLocationID = optionalID(input.BinLocationID)
+			}
+		}
+
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			quantity, err := models.ToBaseQuantity(tx, movement.ProductID, input.UnitOfMeasureID, movement.Quantity)
+			if err != nil {
+				return newRequestError(http.StatusBadRequest, "%s", err.Error())
+			}
+			if quantity != 0 {
+				movement.UnitCost = input.UnitCost * movement.Quantity / quantity
+			}
+			movement.Quantity = quantity
+			return inventory.Post(tx, &movement)
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, movement)
+	}
+}
+
+// expiringStockHandler lists lot stock that expires within the next N days
+// (default 30), including lots that have already expired, soonest first
+func expiringStockHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+		if err != nil || days < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a non-negative number"})
+			return
+		}
+		until := time.Now().AddDate(0, 0, days)
+
+		query := db.Preload("Product").Preload("BinLocation").Preload("Lot").
+			Joins("JOIN lots ON lots.id = stock_levels.lot_id").
+			Where("stock_levels.quantity > 0 AND lots.expires_at <= ?", until)
+		if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+			query = query.Where("stock_levels.bin_location_id IN (?)",
+				db.Model(&models.BinLocation{}).Select("id").Where("warehouse_id = ?", warehouseID))
+		}
+
+		var levels []models.StockLevel
+		if err := query.Order("lots.expires_at, stock_levels.id").Find(&levels).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": levels})
+	}
+}
+
+// optionalID converts a zero ID from a request body into a nil pointer
+func optionalID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// binStock is one row of the per-location stock breakdown
+type binStock struct {
+	BinLocationID uint    `json:"bin_location_id"`
+	BinCode       string  `json:"bin_code"`
+	ZoneCode      string  `json:"zone_code"`
+	LotNumber     string  `json:"lot_number,omitempty"`
+	Quantity      float64 `json:"quantity"`
+	Reserved      float64 `json:"reserved"`
+	Available     float64 `json:"available"`
+}
+
+// warehouseStock groups bin stock rows under their warehouse
+type warehouseStock struct {
+	WarehouseID   uint       `json:"warehouse_id"`
+	WarehouseCode string     `json:"warehouse_code"`
+	WarehouseName string     `json:"warehouse_name"`
+	Quantity      float64    `json:"quantity"`
+	Reserved      float64    `json:"reserved"`
+	Available     float64    `json:"available"`
+	InTransit     float64    `json:"in_transit"`
+	Bins          []binStock `json:"bins"`
+}
+
+// productStockHandler returns the on-hand, reserved and available-to-promise
+// quantity of a product, in its base unit, broken down by warehouse and bin.
+// Stock shipped to a warehouse on a transfer order is reported as in_transit
+// and not counted as on hand until it is received.
+func productStockHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var product models.Product
+		if err := db.Preload("BaseUnit").First(&product, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		unit := ""
+		if product.BaseUnit != nil {
+			unit = product.BaseUnit.Code
+		}
+
+		var rows []struct {
+			WarehouseID   uint
+			WarehouseCode string
+			WarehouseName string
+			BinLocationID uint
+			BinCode       string
+			BinType       string
+			ZoneCode      string
+			LotNumber     string
+			Quantity      float64
+			Reserved      float64
+		}
+		err := db.Table("stock_levels").
+			Select("warehouses.id AS warehouse_id, warehouses.code AS warehouse_code, warehouses.name AS warehouse_name, "+
+				"bin_locations.id AS bin_location_id, bin_locations.code AS bin_code, bin_locations.type AS bin_type, zones.code AS zone_code, "+
+				"COALESCE(lots.number, '') AS lot_number, stock_levels.quantity, stock_levels.reserved").
+			Joins("JOIN bin_locations ON bin_locations.id = stock_levels.bin_location_id AND bin_locations.deleted_at IS NULL").
+			Joins("JOIN zones ON zones.id = bin_locations.zone_id").
+			Joins("JOIN warehouses ON warehouses.id = bin_locations.warehouse_id").
+			Joins("LEFT JOIN lots ON lots.id = stock_levels.lot_id").
+			Where("stock_levels.product_id = ? AND stock_levels.quantity <> 0 AND stock_levels.deleted_at IS NULL", product.ID).
+			Order("warehouses.code, bin_locations.code, lots.number").
+			Scan(&rows).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		warehouses := []warehouseStock{}
+		var total, reserved, inTransit float64
+		for _, row := range rows {
+			if len(warehouses) == 0 || warehouses[len(warehouses)-1].WarehouseID != row.WarehouseID {
+				warehouses = append(warehouses, warehouseStock{
+					WarehouseID:   row.WarehouseID,
+					WarehouseCode: row.WarehouseCode,
+					WarehouseName: row.WarehouseName,
+					Bins:          []binStock{},
+				})
+			}
+			w := &warehouses[len(warehouses)-1]
+			if row.BinType == models.BinTypeTransit {
+				w.InTransit += row.Quantity
+				inTransit += row.Quantity
+				continue
+			}
+			w.Quantity += row.Quantity
+			w.Reserved += row.Reserved
+			w.Available = w.Quantity - w.Reserved
+			w.Bins = append(w.Bins, binStock{
+				BinLocationID: row.BinLocationID,
+				BinCode:       row.BinCode,
+				ZoneCode:      row.ZoneCode,
+				LotNumber:     row.LotNumber,
+				Quantity:      row.Quantity,
+				Reserved:      row.Reserved,
+				Available:     row.Quantity - row.Reserved,
+			})
+			total += row.Quantity
+			reserved += row.Reserved
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"product_id": product.ID,
+			"name":       product.Name,
+			"unit":       unit,
+			"quantity":   total,
+			"reserved":   reserved,
+			"available":  total - reserved,
+			"in_transit": inTransit,
+			"warehouses": warehouses,
+		})
+	}
+}
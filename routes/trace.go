@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterTraceRoutes sets up the lot and serial number trace routes used for recalls
+func RegisterTraceRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	trace := rg.Group("/trace")
+	trace.Use(middleware.AuthMiddleware())
+	{
+		trace.GET("/serials/:number", traceSerialHandler(db))
+		trace.GET("/lots/:number", traceLotHandler(db))
+	}
+}
+
+// traceSerialHandler returns where a serial number is now and every movement
+// it went through. Pass product_id when the same number exists for several products.
+func traceSerialHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Preload("Product").Preload("BinLocation").Where("number = ?", c.Param("number"))
+		if productID := c.Query("product_id"); productID != "" {
+			query = query.Where("product_id = ?", productID)
+		}
+
+		var serials []models.SerialNumber
+		if err := query.Order("id").Find(&serials).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(serials) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Serial number not found"})
+			return
+		}
+
+		data := make([]gin.H, 0, len(serials))
+		for _, serial := range serials {
+			var movements []models.StockMovement
+			err := db.Preload("FromBinLocation").Preload("ToBinLocation").
+				Where("id IN (?)", db.Table("stock_movement_serials").Select("stock_movement_id").Where("serial_number_id = ?", serial.ID)).
+				Order("id").
+				Find(&movements).Error
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			data = append(data, gin.H{"serial": serial, "movements": movements})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": data})
+	}
+}
+
+// lotOrder is a sales order that was shipped stock of a traced lot
+type lotOrder struct {
+	SalesOrderID uint    `json:"sales_order_id"`
+	Number       string  `json:"number"`
+	CustomerID   uint    `json:"customer_id"`
+	CustomerCode string  `json:"customer_code"`
+	CustomerName string  `json:"customer_name"`
+	Quantity     float64 `json:"quantity"`
+}
+
+// traceLotHandler returns the movements of a lot and the sales orders that
+// were shipped stock from it. Pass product_id when the same number exists
+// for several products.
+func traceLotHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Preload("Product").Where("number = ?", c.Param("number"))
+		if productID := c.Query("product_id"); productID != "" {
+			query = query.Where("product_id = ?", productID)
+		}
+
+		var lots []models.Lot
+		if err := query.Order("id").Find(&lots).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(lots) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Lot not found"})
+			return
+		}
+
+		data := make([]gin.H, 0, len(lots))
+		for _, lot := range lots {
+			var movements []models.StockMovement
+			err := db.Preload("FromBinLocation").Preload("ToBinLocation").
+				Where("lot_id = ?", lot.ID).
+				Order("id").
+				Find(&movements).Error
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			orders := []lotOrder{}
+			err = db.Table("stock_movements").
+				Select("sales_orders.id AS sales_order_id, sales_orders.number, customers.id AS customer_id, "+
+					"customers.code AS customer_code, customers.name AS customer_name, SUM(stock_movements.quantity) AS quantity").
+				Joins("JOIN sales_orders ON sales_orders.id = stock_movements.reference_id").
+				Joins("JOIN customers ON customers.id = sales_orders.customer_id").
+				Where("stock_movements.lot_id = ? AND stock_movements.type = ? AND stock_movements.reference_type = ?",
+					lot.ID, models.MovementIssue, models.ReferenceSalesOrder).
+				Where("stock_movements.deleted_at IS NULL").
+				Group("sales_orders.id, sales_orders.number, customers.id, customers.code, customers.name").
+				Order("sales_orders.id").
+				Scan(&orders).Error
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			data = append(data, gin.H{"lot": lot, "movements": movements, "sales_orders": orders})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": data})
+	}
+}
@@ -0,0 +1,459 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterTransferOrderRoutes sets up the routes for inter-warehouse transfer orders
+func RegisterTransferOrderRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	transferCtrl := restful.NewCrudController[models.TransferOrder](db)
+
+	transfers := rg.Group("/transfer-orders")
+	transfers.Use(middleware.AuthMiddleware())
+	{
+		transfers.GET("", transferCtrl.Index)
+		transfers.GET("/:id", transferCtrl.Show)
+		transfers.POST("", storeTransferOrderHandler(db))
+		transfers.POST("/:id/ship", shipTransferOrderHandler(db))
+		transfers.POST("/:id/receive", receiveTransferOrderHandler(db))
+		transfers.POST("/:id/cancel", cancelTransferOrderHandler(db))
+	}
+}
+
+// storeTransferOrderHandler creates a draft transfer order between two warehouses
+func storeTransferOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			FromWarehouseID uint   `json:"from_warehouse_id" binding:"required"`
+			ToWarehouseID   uint   `json:"to_warehouse_id" binding:"required,nefield=FromWarehouseID"`
+			Notes           string `json:"notes"`
+			Lines           []struct {
+				ProductID uint    `json:"product_id" binding:"required"`
+				Quantity  float64 `json:"quantity" binding:"required,gt=0"`
+			} `json:"lines" binding:"required,min=1,dive"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var order models.TransferOrder
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, id := range []uint{input.FromWarehouseID, input.ToWarehouseID} {
+				if err := tx.First(&models.Warehouse{}, id).Error; err != nil {
+					return newRequestError(http.StatusBadRequest, "warehouse %d not found", id)
+				}
+			}
+
+			order = models.TransferOrder{
+				FromWarehouseID: input.FromWarehouseID,
+				ToWarehouseID:   input.ToWarehouseID,
+				Status:          models.TransferOrderDraft,
+				Notes:           input.Notes,
+				UserID:          middleware.CurrentUserID(c),
+			}
+			for _, l := range input.Lines {
+				var product models.Product
+				if err := tx.First(&product, l.ProductID).Error; err != nil {
+					return newRequestError(http.StatusBadRequest, "product %d not found", l.ProductID)
+				}
+				if !product.Divisible && l.Quantity != math.Trunc(l.Quantity) {
+					return newRequestError(http.StatusBadRequest, "product %d is not divisible, quantity must be a whole number", product.ID)
+				}
+				order.Lines = append(order.Lines, models.TransferOrderLine{ProductID: product.ID, Quantity: l.Quantity})
+			}
+
+			return tx.Create(&order).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, order)
+	}
+}
+
+// shipTransferOrderHandler moves every line of a draft transfer order from the
+// storage bins of the source warehouse into the in-transit bin of the
+// destination warehouse. Lines may name a preferred source bin and a lot;
+// serial-tracked lines must list the serials that are shipped.
+func shipTransferOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Lines []struct {
+				TransferOrderLineID uint     `json:"transfer_order_line_id" binding:"required"`
+				BinLocationID       uint     `json:"bin_location_id"`
+				LotNumber           string   `json:"lot_number"`
+				SerialNumbers       []string `json:"serial_numbers"`
+			} `json:"lines" binding:"dive"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var order models.TransferOrder
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			if err := lockTransferOrder(tx, c.Param("id"), &order); err != nil {
+				return err
+			}
+			if order.Status != models.TransferOrderDraft {
+				return newRequestError(http.StatusConflict, "cannot ship a transfer order in status %s", order.Status)
+			}
+			if err := tx.Preload("Product").Where("transfer_order_id = ?", order.ID).Order("id").Find(&order.Lines).Error; err != nil {
+				return err
+			}
+			for _, l := range input.Lines {
+				if findTransferOrderLine(order.Lines, l.TransferOrderLineID) == nil {
+					return newRequestError(http.StatusBadRequest, "line %d does not belong to transfer order %s", l.TransferOrderLineID, order.Number)
+				}
+			}
+			transitID, err := inventory.TransitBin(tx, order.ToWarehouseID)
+			if err != nil {
+				return err
+			}
+
+			for i := range order.Lines {
+				line := &order.Lines[i]
+				movement := models.StockMovement{
+					Type:            models.MovementTransfer,
+					ProductID:       line.ProductID,
+					ToBinLocationID: &transitID,
+					Quantity:        line.Quantity,
+					Reason:          fmt.Sprintf("Shipped on %s", order.Number),
+					ReferenceType:   models.ReferenceTransferOrder,
+					ReferenceID:     order.ID,
+					UserID:          middleware.CurrentUserID(c),
+				}
+				for _, l := range input.Lines {
+					if l.TransferOrderLineID == line.ID {
+						movement.FromBinLocationID = optionalID(l.BinLocationID)
+						movement.LotNumber = l.LotNumber
+						movement.SerialNumbers = l.SerialNumbers
+					}
+				}
+
+				if line.Product.Tracking == models.TrackingSerial {
+					err = shipSerials(tx, movement, order.FromWarehouseID)
+				} else {
+					err = inventory.Draw(tx, movement, order.FromWarehouseID)
+				}
+				if err != nil {
+					return fmt.Errorf("line %d: %w", line.ID, err)
+				}
+
+				line.ShippedQuantity = line.Quantity
+				if err := tx.Model(line).Update("shipped_quantity", line.ShippedQuantity).Error; err != nil {
+					return err
+				}
+			}
+
+			now := time.Now()
+			order.Status = models.TransferOrderInTransit
+			order.ShippedAt = &now
+			return tx.Model(&order).Select("status", "shipped_at").Updates(&order).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// receiveTransferOrderHandler moves goods from the in-transit bin into a
+// storage bin of the destination warehouse. Without lines everything still in
+// transit is received. A line with a discrepancy_reason writes off whatever
+// it still has in transit after the receipt as missing.
+func receiveTransferOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			BinLocationID uint `json:"bin_location_id" binding:"required"`
+			Lines         []struct {
+				TransferOrderLineID uint     `json:"transfer_order_line_id" binding:"required"`
+				Quantity            float64  `json:"quantity" binding:"gte=0"`
+				SerialNumbers       []string `json:"serial_numbers"`
+				DiscrepancyReason   string   `json:"discrepancy_reason"`
+			} `json:"lines" binding:"dive"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var order models.TransferOrder
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			if err := lockTransferOrder(tx, c.Param("id"), &order); err != nil {
+				return err
+			}
+			if order.Status != models.TransferOrderInTransit && order.Status != models.TransferOrderPartiallyReceived {
+				return newRequestError(http.StatusConflict, "cannot receive a transfer order in status %s", order.Status)
+			}
+			if err := tx.Preload("Product").Where("transfer_order_id = ?", order.ID).Order("id").Find(&order.Lines).Error; err != nil {
+				return err
+			}
+			binID, err := binOfType(tx, order.ToWarehouseID, input.BinLocationID, models.BinTypeStorage)
+			if err != nil {
+				return err
+			}
+			transitID, err := inventory.TransitBin(tx, order.ToWarehouseID)
+			if err != nil {
+				return err
+			}
+
+			receipt := receiptOfTransfer{tx: tx, order: &order, transitID: transitID, userID: middleware.CurrentUserID(c)}
+			if len(input.Lines) == 0 {
+				for i := range order.Lines {
+					if err := receipt.receive(&order.Lines[i], binID, order.Lines[i].InTransit(), nil); err != nil {
+						return err
+					}
+				}
+			}
+			for _, l := range input.Lines {
+				line := findTransferOrderLine(order.Lines, l.TransferOrderLineID)
+				if line == nil {
+					return newRequestError(http.StatusBadRequest, "line %d does not belong to transfer order %s", l.TransferOrderLineID, order.Number)
+				}
+				if l.Quantity > line.InTransit()+1e-9 {
+					return newRequestError(http.StatusUnprocessableEntity, "line %d only has %g in transit", line.ID, line.InTransit())
+				}
+				if err := receipt.receive(line, binID, l.Quantity, l.SerialNumbers); err != nil {
+					return err
+				}
+				if l.DiscrepancyReason != "" {
+					if err := receipt.writeOff(line, l.DiscrepancyReason); err != nil {
+						return err
+					}
+				}
+			}
+
+			order.Status = models.TransferOrderReceived
+			for _, line := range order.Lines {
+				if line.InTransit() > 1e-9 {
+					order.Status = models.TransferOrderPartiallyReceived
+					break
+				}
+			}
+			if order.Status == models.TransferOrderReceived {
+				now := time.Now()
+				order.ReceivedAt = &now
+			}
+			return tx.Model(&order).Select("status", "received_at").Updates(&order).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// cancelTransferOrderHandler cancels a transfer order that has not been shipped
+func cancelTransferOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var order models.TransferOrder
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockTransferOrder(tx, c.Param("id"), &order); err != nil {
+				return err
+			}
+			if order.Status != models.TransferOrderDraft {
+				return newRequestError(http.StatusConflict, "cannot cancel a transfer order in status %s", order.Status)
+			}
+			order.Status = models.TransferOrderCancelled
+			return tx.Model(&order).Update("status", order.Status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// shipSerials transfers the listed serials from the storage bins of a
+// warehouse, posting one movement per bin they are taken from
+func shipSerials(tx *gorm.DB, m models.StockMovement, warehouseID uint) error {
+	if m.Quantity != float64(len(m.SerialNumbers)) {
+		return fmt.Errorf("%w: product %d is serial tracked, expected %g serial numbers but got %d",
+			inventory.ErrInvalidMovement, m.ProductID, m.Quantity, len(m.SerialNumbers))
+	}
+
+	var serials []models.SerialNumber
+	err := tx.Where("product_id = ? AND number IN ? AND status = ?", m.ProductID, m.SerialNumbers, models.SerialInStock).
+		Where("bin_location_id IN (?)", tx.Model(&models.BinLocation{}).Select("id").
+			Where("warehouse_id = ? AND type = ?", warehouseID, models.BinTypeStorage)).
+		Order("bin_location_id, number").
+		Find(&serials).Error
+	if err != nil {
+		return err
+	}
+	if len(serials) != len(m.SerialNumbers) {
+		return fmt.Errorf("%w: not every serial is in a storage bin of warehouse %d", inventory.ErrInvalidMovement, warehouseID)
+	}
+
+	for start := 0; start < len(serials); {
+		end := start
+		movement := m
+		movement.FromBinLocationID = serials[start].BinLocationID
+		movement.SerialNumbers = nil
+		for end < len(serials) && *serials[end].BinLocationID == *movement.FromBinLocationID {
+			movement.SerialNumbers = append(movement.SerialNumbers, serials[end].Number)
+			end++
+		}
+		movement.Quantity = float64(len(movement.SerialNumbers))
+		if err := inventory.Post(tx, &movement); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// receiptOfTransfer posts the movements out of the in-transit bin for one
+// receipt of a transfer order
+type receiptOfTransfer struct {
+	tx        *gorm.DB
+	order     *models.TransferOrder
+	transitID uint
+	userID    uint
+}
+
+// receive moves qty of a line from transit into a storage bin. Serial-tracked
+// lines must list the serials unless everything still in transit is received.
+func (r receiptOfTransfer) receive(line *models.TransferOrderLine, binID uint, qty float64, serialNumbers []string) error {
+	if qty <= 0 {
+		return nil
+	}
+	movement := r.movement(line, fmt.Sprintf("Received on %s", r.order.Number))
+	movement.ToBinLocationID = &binID
+
+	if err := r.post(line, movement, qty, serialNumbers); err != nil {
+		return err
+	}
+	line.ReceivedQuantity += qty
+	return r.tx.Model(line).Update("received_quantity", line.ReceivedQuantity).Error
+}
+
+// writeOff records what a line still has in transit as missing and removes
+// it from the in-transit bin
+func (r receiptOfTransfer) writeOff(line *models.TransferOrderLine, reason string) error {
+	qty := line.InTransit()
+	if qty <= 1e-9 {
+		return nil
+	}
+	movement := r.movement(line, fmt.Sprintf("Missing on receipt of %s: %s", r.order.Number, reason))
+	movement.Type = models.MovementAdjust
+
+	if err := r.post(line, movement, qty, nil); err != nil {
+		return err
+	}
+	line.DiscrepancyQuantity += qty
+	line.DiscrepancyReason = reason
+	return r.tx.Model(line).Select("discrepancy_quantity", "discrepancy_reason").Updates(line).Error
+}
+
+// movement builds a movement out of the in-transit bin for a line
+func (r receiptOfTransfer) movement(line *models.TransferOrderLine, reason string) models.StockMovement {
+	return models.StockMovement{
+		Type:              models.MovementTransfer,
+		ProductID:         line.ProductID,
+		FromBinLocationID: &r.transitID,
+		Reason:            reason,
+		ReferenceType:     models.ReferenceTransferOrder,
+		ReferenceID:       r.order.ID,
+		UserID:            r.userID,
+	}
+}
+
+// post takes qty of a line out of transit, lot by lot or by serial
+func (r receiptOfTransfer) post(line *models.TransferOrderLine, m models.StockMovement, qty float64, serialNumbers []string) error {
+	if line.Product.Tracking == models.TrackingSerial {
+		inTransit, err := inventory.TransitSerials(r.tx, r.order.ID, line.ProductID, r.transitID)
+		if err != nil {
+			return err
+		}
+		if len(serialNumbers) == 0 {
+			if qty < line.InTransit() {
+				return newRequestError(http.StatusBadRequest, "line %d is serial tracked, list the serial numbers received", line.ID)
+			}
+			serialNumbers = inTransit
+		}
+		shipped := map[string]bool{}
+		for _, number := range inTransit {
+			shipped[number] = true
+		}
+		for _, number := range serialNumbers {
+			if !shipped[number] {
+				return newRequestError(http.StatusUnprocessableEntity, "serial %s is not in transit on %s", number, r.order.Number)
+			}
+		}
+		m.Quantity = qty
+		m.SerialNumbers = serialNumbers
+		if err := inventory.Post(r.tx, &m); err != nil {
+			return fmt.Errorf("line %d: %w", line.ID, err)
+		}
+		return nil
+	}
+
+	lots, err := inventory.TransitLots(r.tx, r.order.ID, line.ProductID, r.transitID)
+	if err != nil {
+		return err
+	}
+	remaining := qty
+	for _, lot := range lots {
+		if remaining <= 1e-9 {
+			break
+		}
+		movement := m
+		movement.Quantity = math.Min(lot.Quantity, remaining)
+		if lot.LotID != 0 {
+			lotID := lot.LotID
+			movement.LotID = &lotID
+		}
+		if err := inventory.Post(r.tx, &movement); err != nil {
+			return fmt.Errorf("line %d: %w", line.ID, err)
+		}
+		remaining -= movement.Quantity
+	}
+	if remaining > 1e-9 {
+		return fmt.Errorf("line %d: %w: %v less in transit than expected", line.ID, inventory.ErrInsufficientStock, remaining)
+	}
+	return nil
+}
+
+// findTransferOrderLine returns the line with the given ID, or nil
+func findTransferOrderLine(lines []models.TransferOrderLine, id uint) *models.TransferOrderLine {
+	for i := range lines {
+		if lines[i].ID == id {
+			return &lines[i]
+		}
+	}
+	return nil
+}
+
+// lockTransferOrder loads a transfer order for update
+func lockTransferOrder(tx *gorm.DB, id string, order *models.TransferOrder) error {
+	if err := inventory.ForUpdate(tx).First(order, "id = ?", id).Error; err != nil {
+		return newRequestError(http.StatusNotFound, "Transfer order not found")
+	}
+	return nil
+}
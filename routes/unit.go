@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterUnitRoutes sets up the routes for units of measure and product unit conversions
+func RegisterUnitRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	unitCtrl := restful.NewCrudController[models.UnitOfMeasure](db)
+	productUnitCtrl := restful.NewCrudController[models.ProductUnit](db)
+
+	units := rg.Group("/units-of-measure")
+	units.Use(middleware.AuthMiddleware())
+	{
+		units.GET("", unitCtrl.Index)
+		units.GET("/:id", unitCtrl.Show)
+		units.POST("", unitCtrl.Store)
+		units.PUT("/:id", unitCtrl.Update)
+		units.DELETE("/:id", unitCtrl.Destroy)
+	}
+
+	productUnits := rg.Group("/product-units")
+	productUnits.Use(middleware.AuthMiddleware())
+	{
+		productUnits.GET("", productUnitCtrl.Index)
+		productUnits.GET("/:id", productUnitCtrl.Show)
+		productUnits.POST("", productUnitCtrl.Store)
+		productUnits.PUT("/:id", productUnitCtrl.Update)
+		productUnits.DELETE("/:id", productUnitCtrl.Destroy)
+	}
+}
+
+// productUnit is a unit a product can be handled in with its size in base units
+type productUnit struct {
+	UnitOfMeasureID uint    `json:"unit_of_measure_id"`
+	Code            string  `json:"code"`
+	Name            string  `json:"name"`
+	BaseQuantity    float64 `json:"base_quantity"`
+}
+
+// productUnitsHandler lists the base unit and every pack size of a product,
+// each resolved to the number of base units it contains
+func productUnitsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var product models.Product
+		if err := db.Preload("BaseUnit").Preload("Units.UnitOfMeasure").First(&product, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		units := []productUnit{}
+		if product.BaseUnit != nil {
+			units = append(units, productUnit{
+				UnitOfMeasureID: product.BaseUnit.ID,
+				Code:            product.BaseUnit.Code,
+				Name:            product.BaseUnit.Name,
+				BaseQuantity:    1,
+			})
+		}
+		for _, conversion := range product.Units {
+			factor, err := models.BaseFactor(db, &product, conversion.UnitOfMeasureID)
+			if err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			unit := productUnit{UnitOfMeasureID: conversion.UnitOfMeasureID, BaseQuantity: factor}
+			if conversion.UnitOfMeasure != nil {
+				unit.Code = conversion.UnitOfMeasure.Code
+				unit.Name = conversion.UnitOfMeasure.Name
+			}
+			units = append(units, unit)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"product_id": product.ID,
+			"divisible":  product.Divisible,
+			"data":       units,
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package routes
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxVariants caps the size of a generated attribute matrix
+const maxVariants = 1000
+
+// generateVariantsHandler creates one variant of a parent product for every
+// combination of the given attribute values. Attributes and values are
+// created on first use and combinations that already exist are skipped.
+func generateVariantsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Attributes []struct {
+				Code   string   `json:"code" binding:"required"`
+				Values []string `json:"values" binding:"required,min=1"`
+			} `json:"attributes" binding:"required,min=1,dive"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// Checked per attribute so the product cannot overflow
+		combinations := 1
+		codes := map[string]bool{}
+		for i, attribute := range input.Attributes {
+			if codes[attribute.Code] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("attribute %s is given more than once", attribute.Code)})
+				return
+			}
+			codes[attribute.Code] = true
+			values := uniqueStrings(attribute.Values)
+			if len(values) == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("attribute %s has no values", attribute.Code)})
+				return
+			}
+			input.Attributes[i].Values = values
+			combinations *= len(values)
+			if combinations > maxVariants {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the matrix would create more than %d variants", maxVariants)})
+				return
+			}
+		}
+
+		created := []models.Product{}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var parent models.Product
+			if err := tx.Preload("Variants.AttributeValues").First(&parent, "id = ?", c.Param("id")).Error; err != nil {
+				return newRequestError(http.StatusNotFound, "Product not found")
+			}
+			if parent.ParentID != nil {
+				return newRequestError(http.StatusBadRequest, "product %d is a variant and cannot have variants", parent.ID)
+			}
+
+			// Resolve every attribute value, keeping the order they were given in
+			axes := make([][]models.AttributeValue, 0, len(input.Attributes))
+			for _, in := range input.Attributes {
+				attribute := models.Attribute{Code: in.Code, Name: in.Code}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&attribute).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("code = ?", in.Code).First(&attribute).Error; err != nil {
+					return err
+				}
+
+				axis := make([]models.AttributeValue, 0, len(in.Values))
+				for i, v := range in.Values {
+					value := models.AttributeValue{AttributeID: attribute.ID, Value: v, Position: i}
+					if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&value).Error; err != nil {
+						return err
+					}
+					if err := tx.Where("attribute_id = ? AND value = ?", attribute.ID, v).First(&value).Error; err != nil {
+						return err
+					}
+					axis = append(axis, value)
+				}
+				axes = append(axes, axis)
+			}
+
+			existing := map[string]bool{}
+			for _, variant := range parent.Variants {
+				existing[variantKey(variant.AttributeValues)] = true
+			}
+
+			variants := []models.Product{}
+			skus := map[string]bool{}
+			for _, combination := range cartesian(axes) {
+				if existing[variantKey(combination)] {
+					continue
+				}
+
+				names := make([]string, 0, len(combination))
+				codes := make([]string, 0, len(combination))
+				for _, value := range combination {
+					names = append(names, value.Value)
+					codes = append(codes, strings.ToUpper(strings.ReplaceAll(value.Value, " ", "")))
+				}
+				variant := models.Product{
+					Name:            fmt.Sprintf("%s - %s", parent.Name, strings.Join(names, " / ")),
+					PriceAmount:     parent.PriceAmount,
+					Currency:        parent.Currency,
+					Status:          parent.Status,
+					Tracking:        parent.Tracking,
+					BaseUnitID:      parent.BaseUnitID,
+					Divisible:       parent.Divisible,
+					ParentID:        &parent.ID,
+					SKU:             parent.SKU + "-" + strings.Join(codes, "-"),
+					AttributeValues: combination,
+				}
+				if skus[variant.SKU] {
+					return newRequestError(http.StatusConflict, "two variants would get sku %s", variant.SKU)
+				}
+				skus[variant.SKU] = true
+				variants = append(variants, variant)
+			}
+
+			// SKUs are unique, deleted products included
+			if len(variants) > 0 {
+				var clash models.Product
+				err := tx.Unscoped().Select("id", "sku").Where("sku IN ?", slices.Collect(maps.Keys(skus))).Limit(1).Find(&clash).Error
+				if err != nil {
+					return err
+				}
+				if clash.ID != 0 {
+					return newRequestError(http.StatusConflict, "sku %s is already used by product %d", clash.SKU, clash.ID)
+				}
+			}
+
+			for _, variant := range variants {
+				if err := tx.Omit("AttributeValues.*").Create(&variant).Error; err != nil {
+					return err
+				}
+				created = append(created, variant)
+			}
+			return nil
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"data": created})
+	}
+}
+
+// cartesian returns every combination taking one value from each axis
+func cartesian(axes [][]models.AttributeValue) [][]models.AttributeValue {
+	combinations := [][]models.AttributeValue{{}}
+	for _, axis := range axes {
+		next := make([][]models.AttributeValue, 0, len(combinations)*len(axis))
+		for _, combination := range combinations {
+			for _, value := range axis {
+				row := append(append([]models.AttributeValue{}, combination...), value)
+				next = append(next, row)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// variantKey identifies a combination of attribute values regardless of order
+func variantKey(values []models.AttributeValue) string {
+	ids := make([]int, 0, len(values))
+	for _, value := range values {
+		ids = append(ids, int(value.ID))
+	}
+	sort.Ints(ids)
+	return fmt.Sprint(ids)
+}
+
+// uniqueStrings returns the non-empty strings in order with duplicates removed
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterWarehouseRoutes sets up the routes for warehouses, zones and bin locations
+func RegisterWarehouseRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	warehouseCtrl := restful.NewCrudController[models.Warehouse](db)
+	zoneCtrl := restful.NewCrudController[models.Zone](db)
+	binCtrl := restful.NewCrudController[models.BinLocation](db)
+
+	warehouses := rg.Group("/warehouses")
+	warehouses.Use(middleware.AuthMiddleware())
+	{
+		warehouses.GET("", warehouseCtrl.Index)
+		warehouses.GET("/:id", warehouseCtrl.Show)
+		warehouses.POST("", warehouseCtrl.Store)
+		warehouses.PUT("/:id", warehouseCtrl.Update)
+		warehouses.DELETE("/:id", warehouseCtrl.Destroy)
+	}
+
+	zones := rg.Group("/zones")
+	zones.Use(middleware.AuthMiddleware())
+	{
+		zones.GET("", zoneCtrl.Index)
+		zones.GET("/:id", zoneCtrl.Show)
+		zones.POST("", zoneCtrl.Store)
+		zones.PUT("/:id", zoneCtrl.Update)
+		zones.DELETE("/:id", zoneCtrl.Destroy)
+	}
+
+	bins := rg.Group("/bin-locations")
+	bins.Use(middleware.AuthMiddleware())
+	{
+		bins.GET("", binCtrl.Index)
+		bins.GET("/:id", binCtrl.Show)
+		bins.POST("", binCtrl.Store)
+		bins.PUT("/:id", binCtrl.Update)
+		bins.DELETE("/:id", binCtrl.Destroy)
+	}
+}
@@ -0,0 +1,267 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/aldhipradana/warehouse-api/inventory"
+	"github.com/aldhipradana/warehouse-api/middleware"
+	"github.com/aldhipradana/warehouse-api/models"
+	"github.com/aldhipradana/warehouse-api/restful"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterWorkOrderRoutes sets up the routes for assembly and disassembly work orders
+func RegisterWorkOrderRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+	workOrderCtrl := restful.NewCrudController[models.WorkOrder](db)
+
+	workOrders := rg.Group("/work-orders")
+	workOrders.Use(middleware.AuthMiddleware())
+	{
+		workOrders.GET("", workOrderCtrl.Index)
+		workOrders.GET("/:id", workOrderCtrl.Show)
+		workOrders.POST("", storeWorkOrderHandler(db))
+		workOrders.POST("/:id/complete", completeWorkOrderHandler(db))
+		workOrders.POST("/:id/cancel", cancelWorkOrderHandler(db))
+	}
+}
+
+// storeWorkOrderHandler creates a draft work order for a kit, copying the
+// component quantities from its bill of materials
+func storeWorkOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Type          string  `json:"type" binding:"required,oneof=assembly disassembly"`
+			ProductID     uint    `json:"product_id" binding:"required"`
+			BinLocationID uint    `json:"bin_location_id" binding:"required"`
+			Quantity      float64 `json:"quantity" binding:"required,gt=0"`
+			LotNumber     string  `json:"lot_number"`
+			Notes         string  `json:"notes"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var order models.WorkOrder
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var product models.Product
+			if err := tx.Preload("Components.Component").First(&product, input.ProductID).Error; err != nil {
+				return newRequestError(http.StatusBadRequest, "product %d not found", input.ProductID)
+			}
+			if len(product.Components) == 0 {
+				return newRequestError(http.StatusBadRequest, "product %d has no bill of materials", product.ID)
+			}
+			if !product.Divisible && input.Quantity != math.Trunc(input.Quantity) {
+				return newRequestError(http.StatusBadRequest, "product %d is not divisible, quantity must be a whole number", product.ID)
+			}
+			if product.Tracking == models.TrackingSerial {
+				return newRequestError(http.StatusBadRequest, "product %d is serial tracked and cannot be assembled by work order", product.ID)
+			}
+			var bin models.BinLocation
+			if err := tx.First(&bin, input.BinLocationID).Error; err != nil {
+				return newRequestError(http.StatusBadRequest, "bin location %d not found", input.BinLocationID)
+			}
+
+			order = models.WorkOrder{
+				Type:          input.Type,
+				Status:        models.WorkOrderDraft,
+				ProductID:     product.ID,
+				WarehouseID:   bin.WarehouseID,
+				BinLocationID: bin.ID,
+				Quantity:      input.Quantity,
+				LotNumber:     input.LotNumber,
+				Notes:         input.Notes,
+				UserID:        middleware.CurrentUserID(c),
+			}
+			for _, line := range product.Components {
+				if line.Component.Tracking == models.TrackingSerial {
+					return newRequestError(http.StatusBadRequest, "component %d is serial tracked and cannot be used by work order", line.ComponentID)
+				}
+				quantity := math.Round(line.Quantity*input.Quantity*1e9) / 1e9
+				if !line.Component.Divisible && quantity != math.Trunc(quantity) {
+					return newRequestError(http.StatusBadRequest, "component %d is not divisible, %v units are needed", line.ComponentID, quantity)
+				}
+				order.Lines = append(order.Lines, models.WorkOrderLine{ProductID: line.ComponentID, Quantity: quantity})
+			}
+
+			return tx.Create(&order).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, order)
+	}
+}
+
+// completeWorkOrderHandler posts the consume and produce movements of a work
+// order in one transaction. Assembly consumes the components from the
+// warehouse (the work order bin first) and produces the kit in the bin;
+// disassembly consumes the kit and produces the components in the bin.
+// Lot-tracked products produced without a lot number get a lot named after
+// the work order. What is produced is valued at the cost of what was consumed.
+func completeWorkOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var order models.WorkOrder
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			if err := lockWorkOrder(tx, c.Param("id"), &order); err != nil {
+				return err
+			}
+			if order.Status != models.WorkOrderDraft {
+				return newRequestError(http.StatusConflict, "work order %s is %s", order.Number, order.Status)
+			}
+			if err := tx.Preload("Product").Where("work_order_id = ?", order.ID).Order("id").Find(&order.Lines).Error; err != nil {
+				return err
+			}
+			var product models.Product
+			if err := tx.First(&product, order.ProductID).Error; err != nil {
+				return err
+			}
+
+			base := models.StockMovement{
+				Reason:        fmt.Sprintf("Work order %s", order.Number),
+				ReferenceType: models.ReferenceWorkOrder,
+				ReferenceID:   order.ID,
+				UserID:        middleware.CurrentUserID(c),
+			}
+			consume := func(productID uint, quantity float64, lotNumber string) error {
+				movement := base
+				movement.ProductID = productID
+				movement.Quantity = quantity
+				movement.LotNumber = lotNumber
+				movement.FromBinLocationID = &order.BinLocationID
+				return inventory.Consume(tx, movement, order.WarehouseID)
+			}
+			produce := func(p models.Product, quantity float64, lotNumber string, cost float64) error {
+				movement := base
+				movement.Type = models.MovementProduce
+				movement.ProductID = p.ID
+				movement.Quantity = quantity
+				movement.UnitCost = cost / quantity
+				movement.ToBinLocationID = &order.BinLocationID
+				if p.Tracking == models.TrackingLot {
+					movement.LotNumber = lotNumber
+					if movement.LotNumber == "" {
+						movement.LotNumber = order.Number
+					}
+				}
+				return inventory.Post(tx, &movement)
+			}
+
+			switch order.Type {
+			case models.WorkOrderAssembly:
+				for _, line := range order.Lines {
+					if err := consume(line.ProductID, line.Quantity, ""); err != nil {
+						return fmt.Errorf("component %d: %w", line.ProductID, err)
+					}
+				}
+				cost, err := workOrderCost(tx, order.ID)
+				if err != nil {
+					return err
+				}
+				if err := produce(product, order.Quantity, order.LotNumber, cost); err != nil {
+					return err
+				}
+			default:
+				if err := consume(product.ID, order.Quantity, order.LotNumber); err != nil {
+					return err
+				}
+				cost, err := workOrderCost(tx, order.ID)
+				if err != nil {
+					return err
+				}
+				shares, err := componentShares(tx, order.Lines, order.WarehouseID)
+				if err != nil {
+					return err
+				}
+				for i, line := range order.Lines {
+					if err := produce(*line.Product, line.Quantity, "", cost*shares[i]); err != nil {
+						return fmt.Errorf("component %d: %w", line.ProductID, err)
+					}
+				}
+			}
+
+			now := time.Now()
+			order.Status = models.WorkOrderCompleted
+			order.CompletedAt = &now
+			return tx.Model(&order).Select("status", "completed_at").Updates(&order).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// cancelWorkOrderHandler cancels a work order that has not been completed
+func cancelWorkOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var order models.WorkOrder
+		err := inventory.Transaction(db, func(tx *gorm.DB) error {
+			if err := lockWorkOrder(tx, c.Param("id"), &order); err != nil {
+				return err
+			}
+			if order.Status != models.WorkOrderDraft {
+				return newRequestError(http.StatusConflict, "work order %s is %s", order.Number, order.Status)
+			}
+			order.Status = models.WorkOrderCancelled
+			return tx.Model(&order).Update("status", order.Status).Error
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// workOrderCost returns the cost of everything a work order has consumed
+func workOrderCost(tx *gorm.DB, orderID uint) (float64, error) {
+	var cost float64
+	err := tx.Model(&models.StockMovement{}).
+		Select("COALESCE(SUM(cost_amount), 0)").
+		Where("type = ? AND reference_type = ? AND reference_id = ?", models.MovementConsume, models.ReferenceWorkOrder, orderID).
+		Scan(&cost).Error
+	return cost, err
+}
+
+// componentShares splits the cost of a disassembled kit over its components
+// in proportion to their current cost, or to their quantity when none has a cost
+func componentShares(tx *gorm.DB, lines []models.WorkOrderLine, warehouseID uint) ([]float64, error) {
+	weights := make([]float64, len(lines))
+	var total, quantity float64
+	for i, line := range lines {
+		cost, err := inventory.UnitCost(tx, line.ProductID, warehouseID)
+		if err != nil {
+			return nil, err
+		}
+		weights[i] = cost * line.Quantity
+		total += weights[i]
+		quantity += line.Quantity
+	}
+	for i, line := range lines {
+		if total > 0 {
+			weights[i] /= total
+		} else {
+			weights[i] = line.Quantity / quantity
+		}
+	}
+	return weights, nil
+}
+
+// lockWorkOrder loads a work order for update
+func lockWorkOrder(tx *gorm.DB, id string, order *models.WorkOrder) error {
+	if err := inventory.ForUpdate(tx).First(order, "id = ?", id).Error; err != nil {
+		return newRequestError(http.StatusNotFound, "Work order not found")
+	}
+	return nil
+}